@@ -8,8 +8,12 @@ package configs
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -21,6 +25,63 @@ import (
 // Paymentology configuration values
 var PaymentologyTerminal		string
 var PaymentologyTerminalPasswd	[]byte
+// Paymentology terminals with their HMAC keys in verification order
+var PaymentologyTerminals = make(map[string][]TerminalKey)
+
+// Terminal HMAC key struct, a zero ValidFrom or
+// ValidTo means the window is open on that side
+type TerminalKey struct {
+	KeyId 		string		`json:"key-id"`
+	Passwd 		string		`json:"password"`
+	ValidFrom 	time.Time	`json:"valid-from"`
+	ValidTo 	time.Time	`json:"valid-to"`
+}
+
+const TERMINAL_DEFAULT_KEY_ID = "default"
+
+// Admin API bearer token, admin requests without it are rejected
+var AdminAPIToken				string
+
+// Paymentology disabled methods, comma separated in PMTOL_DISABLED_METHODS
+var PaymentologyDisabledMethods	[]string
+
+// PIN validation configuration values
+var PINMaxTries					int = PIN_MAX_TRIES_DEFAULT
+const PIN_MAX_TRIES_DEFAULT		int = 3
+
+// Paymentology transaction date replay window, requests with a TxDate
+// out of the window are declined. Dates without time zone are in the
+// PMTOL_TX_DATE_LOCATION time zone
+var TxDateMaxSkew				time.Duration = TX_DATE_MAX_SKEW_DEFAULT
+var TxDateLocation				*time.Location = time.UTC
+const TX_DATE_MAX_SKEW_DEFAULT	time.Duration = 15 * time.Minute
+
+// Parked reversals job values, reversals pending for more than
+// PendingReversalTTL are expired and reported
+var PendingReversalTTL			time.Duration = PENDING_REVERSAL_TTL_DEFAULT
+var PendingReversalJobInterval	time.Duration = PENDING_REVERSAL_JOB_INTERVAL_DEFAULT
+const PENDING_REVERSAL_TTL_DEFAULT			time.Duration = 24 * time.Hour
+const PENDING_REVERSAL_JOB_INTERVAL_DEFAULT	time.Duration = 10 * time.Minute
+
+// Currency mismatch configuration values, a request in a currency
+// different from the wallet currency is declined or converted with
+// the rate from the transaction currency to the wallet currency
+var CurrencyMismatchAction		string = CURRENCY_MISMATCH_DECLINE
+var CurrencyRates = make(map[string]*big.Rat)
+const CURRENCY_MISMATCH_DECLINE	string = "decline"
+const CURRENCY_MISMATCH_CONVERT	string = "convert"
+
+// ATM cash withdrawal detection values, the KLV field names of the
+// terminal type and the transaction type, the terminal types and the
+// transaction type prefixes of an ATM cash withdrawal
+var ATMTerminalTypeField		string = ATM_TERMINAL_TYPE_FIELD_DEFAULT
+var ATMTerminalTypes			= []string{ATM_TERMINAL_TYPES_DEFAULT}
+var ATMTransactionTypeField		string = ATM_TRANSACTION_TYPE_FIELD_DEFAULT
+var ATMTransactionTypes			= []string{ATM_TRANSACTION_TYPES_DEFAULT}
+const ATM_TERMINAL_TYPE_FIELD_DEFAULT		string = "TerminalType"
+const ATM_TERMINAL_TYPES_DEFAULT			string = "ATM"
+const ATM_TRANSACTION_TYPE_FIELD_DEFAULT	string = "TransactionType"
+const ATM_TRANSACTION_TYPES_DEFAULT			string = "01"
 
 // AWS configuration values
 var AWSRegion = ""
@@ -58,7 +119,28 @@ func LoadConfig() error {
 	if awsSecret != nil {
 		PaymentologyTerminal = awsSecret["paymentology-terminal"]
 		PaymentologyTerminalPasswd = []byte(awsSecret["paymentology-terminal-password"])
-		logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- %s", "Paymentology terminal values has been set"))
+		if PaymentologyTerminal != "" {
+			PaymentologyTerminals[PaymentologyTerminal] = []TerminalKey{
+				{KeyId: TERMINAL_DEFAULT_KEY_ID, Passwd: string(PaymentologyTerminalPasswd)},
+			}
+		}
+
+		// additional terminals, json object with terminal id and
+		// password pairs or terminal id and ordered keys pairs
+		if awsSecret["paymentology-terminals"] != "" {
+			err = loadTerminals(awsSecret["paymentology-terminals"])
+			if err != nil {
+				return fmt.Errorf(helpers.GetFunctionName() + "- loading paymentology-terminals error=%s", err.Error())
+			}
+		}
+		logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- Paymentology terminal values has been set for %d terminals",
+			len(PaymentologyTerminals)))
+
+		// admin api token
+		AdminAPIToken = awsSecret["admin-api-token"]
+		if AdminAPIToken == "" {
+			logger.LogWarning(fmt.Sprintf(helpers.GetFunctionName() + "- %s", "admin-api-token not set, admin requests are rejected"))
+		}
 	} else {
 		logger.LogError(fmt.Sprintf(helpers.GetFunctionName() + "- %s", "Paymentology terminal values not set"))
 	}
@@ -77,7 +159,99 @@ func LoadConfig() error {
 		logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- %s", "APP_DB_CONN_WRITE environment variable has been set"))
 	}
 
-	
+	// pin validation variables
+	maxTries, ok := os.LookupEnv("PIN_MAX_TRIES")
+	if ok && maxTries != "" {
+		PINMaxTries, err = strconv.Atoi(maxTries)
+		if err != nil || PINMaxTries <= 0 {
+			return fmt.Errorf(helpers.GetFunctionName() + "- %s", "PIN_MAX_TRIES environment variable is not a valid number")
+		}
+	}
+	logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- PIN max tries has been set to %d", PINMaxTries))
+
+	// transaction date variables
+	maxSkew, ok := os.LookupEnv("PMTOL_TX_DATE_MAX_SKEW")
+	if ok && maxSkew != "" {
+		TxDateMaxSkew, err = time.ParseDuration(maxSkew)
+		if err != nil || TxDateMaxSkew <= 0 {
+			return fmt.Errorf(helpers.GetFunctionName() + "- %s", "PMTOL_TX_DATE_MAX_SKEW environment variable is not a valid duration")
+		}
+	}
+	location, ok := os.LookupEnv("PMTOL_TX_DATE_LOCATION")
+	if ok && location != "" {
+		TxDateLocation, err = time.LoadLocation(location)
+		if err != nil {
+			return fmt.Errorf(helpers.GetFunctionName() + "- %s", "PMTOL_TX_DATE_LOCATION environment variable is not a valid time zone")
+		}
+	}
+	logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- transaction date max skew has been set to %s location=%s",
+		TxDateMaxSkew, TxDateLocation))
+
+	// parked reversals job variables
+	reversalTTL, ok := os.LookupEnv("PMTOL_PENDING_REVERSAL_TTL")
+	if ok && reversalTTL != "" {
+		PendingReversalTTL, err = time.ParseDuration(reversalTTL)
+		if err != nil || PendingReversalTTL <= 0 {
+			return fmt.Errorf(helpers.GetFunctionName() + "- %s", "PMTOL_PENDING_REVERSAL_TTL environment variable is not a valid duration")
+		}
+	}
+	jobInterval, ok := os.LookupEnv("PMTOL_PENDING_REVERSAL_JOB_INTERVAL")
+	if ok && jobInterval != "" {
+		PendingReversalJobInterval, err = time.ParseDuration(jobInterval)
+		if err != nil || PendingReversalJobInterval <= 0 {
+			return fmt.Errorf(helpers.GetFunctionName() + "- %s", "PMTOL_PENDING_REVERSAL_JOB_INTERVAL environment variable is not a valid duration")
+		}
+	}
+	logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- pending reversals ttl has been set to %s job interval=%s",
+		PendingReversalTTL, PendingReversalJobInterval))
+
+	// currency mismatch variables
+	mismatchAction, ok := os.LookupEnv("PMTOL_CURRENCY_MISMATCH")
+	if ok && mismatchAction != "" {
+		if mismatchAction != CURRENCY_MISMATCH_DECLINE && mismatchAction != CURRENCY_MISMATCH_CONVERT {
+			return fmt.Errorf(helpers.GetFunctionName() + "- %s", "PMTOL_CURRENCY_MISMATCH environment variable must be decline or convert")
+		}
+		CurrencyMismatchAction = mismatchAction
+	}
+	currencyRates, ok := os.LookupEnv("PMTOL_CURRENCY_RATES")
+	if ok && currencyRates != "" {
+		err = loadCurrencyRates(currencyRates)
+		if err != nil {
+			return fmt.Errorf(helpers.GetFunctionName() + "- loading PMTOL_CURRENCY_RATES error=%s", err.Error())
+		}
+	}
+	logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- currency mismatch action has been set to %s with %d rates",
+		CurrencyMismatchAction, len(CurrencyRates)))
+
+	// atm cash withdrawal detection variables
+	terminalTypeField, ok := os.LookupEnv("PMTOL_ATM_TERMINAL_TYPE_FIELD")
+	if ok && terminalTypeField != "" {
+		ATMTerminalTypeField = strings.TrimSpace(terminalTypeField)
+	}
+	terminalTypes, ok := os.LookupEnv("PMTOL_ATM_TERMINAL_TYPES")
+	if ok && terminalTypes != "" {
+		ATMTerminalTypes = splitList(terminalTypes)
+	}
+	txTypeField, ok := os.LookupEnv("PMTOL_ATM_TRANSACTION_TYPE_FIELD")
+	if ok && txTypeField != "" {
+		ATMTransactionTypeField = strings.TrimSpace(txTypeField)
+	}
+	txTypes, ok := os.LookupEnv("PMTOL_ATM_TRANSACTION_TYPES")
+	if ok && txTypes != "" {
+		ATMTransactionTypes = splitList(txTypes)
+	}
+	logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- ATM cash withdrawals %s=%s or %s starting with %s",
+		ATMTerminalTypeField, strings.Join(ATMTerminalTypes, "|"), ATMTransactionTypeField, strings.Join(ATMTransactionTypes, "|")))
+
+	// paymentology disabled methods
+	disabledMethods, ok := os.LookupEnv("PMTOL_DISABLED_METHODS")
+	if ok && disabledMethods != "" {
+		for _, method := range strings.Split(disabledMethods, ",") {
+			PaymentologyDisabledMethods = append(PaymentologyDisabledMethods, strings.TrimSpace(method))
+		}
+		logger.LogInfo(fmt.Sprintf(helpers.GetFunctionName() + "- Paymentology disabled methods=%s", disabledMethods))
+	}
+
 	// build connection strings
 	ConnStrRead = getConnUrl(connRead)
 	if ConnStrRead == "" {
@@ -92,6 +266,103 @@ func LoadConfig() error {
 }
 
 
+// Function loadTerminals adds the terminals from a json object,
+// each terminal value is a password or an ordered list of keys
+//   {"T1": "passwd", "T2": [{"key-id": "2022-06", "password": "new", "valid-from": "2022-06-01T00:00:00Z"},
+//                          {"key-id": "2021-01", "password": "old", "valid-to": "2022-06-15T00:00:00Z"}]}
+func loadTerminals(terminals string) error {
+
+	var terminalMap map[string]json.RawMessage
+	err := json.Unmarshal([]byte(terminals), &terminalMap)
+	if err != nil {
+		return err
+	}
+
+	for terminal, value := range terminalMap {
+		var keys []TerminalKey
+
+		// single password or list of keys
+		var passwd string
+		if json.Unmarshal(value, &passwd) == nil {
+			keys = []TerminalKey{{KeyId: TERMINAL_DEFAULT_KEY_ID, Passwd: passwd}}
+		} else {
+			err = json.Unmarshal(value, &keys)
+			if err != nil {
+				return fmt.Errorf("terminal %s keys error=%s", terminal, err.Error())
+			}
+		}
+
+		// check values
+		if terminal == "" || len(keys) == 0 {
+			return fmt.Errorf("terminal id and keys cannot be empty")
+		}
+		for _, key := range keys {
+			if key.KeyId == "" || key.Passwd == "" {
+				return fmt.Errorf("terminal %s key id and password cannot be empty", terminal)
+			}
+		}
+		PaymentologyTerminals[terminal] = keys
+	}
+
+	return nil
+}
+
+
+// Function loadCurrencyRates adds the exchange rates from a json object,
+// each key is the transaction and wallet ISO 4217 numeric codes pair and
+// the value is the decimal rate from the transaction to the wallet currency
+//   {"840:484": "17.0512", "978:484": "18.4230"}
+func loadCurrencyRates(rates string) error {
+
+	var rateMap map[string]string
+	err := json.Unmarshal([]byte(rates), &rateMap)
+	if err != nil {
+		return err
+	}
+
+	for pair, value := range rateMap {
+		currencies := strings.Split(pair, ":")
+		if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+			return fmt.Errorf("currency pair %s is not valid", pair)
+		}
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return fmt.Errorf("currency pair %s rate=%s is not valid", pair, value)
+		}
+		CurrencyRates[CurrencyPair(currencies[0], currencies[1])] = rate
+	}
+
+	return nil
+}
+
+
+// Function splitList splits a comma separated list, the
+// values are trimmed and the empty values are skipped
+func splitList(list string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+
+// Function CurrencyPair builds the rates key of a currency pair
+func CurrencyPair(fromCurrency string, toCurrency string) string {
+	return fromCurrency + ":" + toCurrency
+}
+
+
+// Function IsActive checks if the key is valid at a time
+func (key *TerminalKey) IsActive(at time.Time) bool {
+	return (key.ValidFrom.IsZero() || !at.Before(key.ValidFrom)) &&
+		(key.ValidTo.IsZero() || at.Before(key.ValidTo))
+}
+
+
 // Function getConnUrl decode the connection url to connection string
 func getConnUrl(envVar string) string {
 
@@ -163,9 +434,6 @@ func getAWSSecret(region string, secretId string) (map[string]string, error) {
 		secretString = *result.SecretString
 	}
 
-	// DEBUG
-	logger.LogInfo(fmt.Sprintf("%s - secretString=%s", helpers.GetFunctionName(), secretString))
-
 	secretMap := make(map[string]string)
 
 	err = json.Unmarshal([]byte(secretString), &secretMap)
@@ -5,10 +5,43 @@
 package handlers
 
 import (
+	"fmt"
+	"strconv"
 	"clevergo.tech/jsend"
 	"github.com/gofiber/fiber/v2"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	card "github.com/kueski-dev/paymentology-paymethods/models/card"
+	lifecycle "github.com/kueski-dev/paymentology-paymethods/models/lifecycle"
+	mcc "github.com/kueski-dev/paymentology-paymethods/models/mcc"
+	message "github.com/kueski-dev/paymentology-paymethods/models/message"
+	request "github.com/kueski-dev/paymentology-paymethods/models/request"
+	reversal "github.com/kueski-dev/paymentology-paymethods/models/reversal"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+	registry "github.com/kueski-dev/paymentology-paymethods/services/registry"
 )
 
+const ADMIN_MESSAGES_DEFAULT_LIMIT = 100
+const ADMIN_RETRIES_DEFAULT_LIMIT = 100
+const ADMIN_REVIEW_DEFAULT_LIMIT = 100
+const ADMIN_PARKED_DEFAULT_LIMIT = 100
+const ADMIN_DEBT_DEFAULT_LIMIT = 100
+
+// MCC rule request JSON struct
+type MCCRuleReqJSON struct {
+	ScopeType 				string				`json:"scope_type"`
+	ScopeId 				string				`json:"scope_id"`
+	MCC 					string				`json:"mcc"`
+	RuleType 				string				`json:"rule_type"`
+}
+
+// Card PIN request JSON struct, the clear PIN or its bcrypt hash
+type CardPINReqJSON struct {
+	PIN 					string				`json:"pin"`
+	PINHash 				string				`json:"pin_hash"`
+}
+
 // Health probe
 func Healthcheck(c *fiber.Ctx) error {
 	return c.SendStatus(200)
@@ -26,4 +59,289 @@ func AdminAboutServiceHandler(c *fiber.Ctx) error {
 	
 	// Send success response
 	return c.Status(fiber.StatusOK).JSON(jsend.New(data))
-}
\ No newline at end of file
+}
+
+
+// Get the latest Paymentology administrative messages
+func AdminMessagesHandler(c *fiber.Ctx) error {
+
+	// get limit parameter
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(ADMIN_MESSAGES_DEFAULT_LIMIT)))
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"limit": "limit must be a positive number"}))
+	}
+
+	// get messages
+	messages, err := message.GetAdminMessages(limit)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(messages))
+}
+
+
+// Get the registered Paymentology methods
+func AdminMethodsHandler(c *fiber.Ctx) error {
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(registry.List()))
+}
+
+
+// Get the checksum keys with their usage counters
+func AdminChecksumKeysHandler(c *fiber.Ctx) error {
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(commons.GetChecksumKeysUsage()))
+}
+
+
+// Get the latest retried Paymentology requests
+func AdminRetriesHandler(c *fiber.Ctx) error {
+
+	// get limit parameter
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(ADMIN_RETRIES_DEFAULT_LIMIT)))
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"limit": "limit must be a positive number"}))
+	}
+
+	// get requests
+	requests, err := request.GetRetriedRequests(limit)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(requests))
+}
+
+
+// Get the original transactions flagged for manual review
+func AdminReviewOriginalsHandler(c *fiber.Ctx) error {
+
+	// get limit parameter
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(ADMIN_REVIEW_DEFAULT_LIMIT)))
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"limit": "limit must be a positive number"}))
+	}
+
+	// get original transactions
+	originals, err := wallet.GetReviewOriginals(limit)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(originals))
+}
+
+
+// Get the latest parked reversals by status
+func AdminParkedReversalsHandler(c *fiber.Ctx) error {
+
+	// get status parameter
+	status := c.Query("status", reversal.PENDING_STATUS_PENDING)
+	if status != reversal.PENDING_STATUS_PENDING && status != reversal.PENDING_STATUS_APPLIED &&
+		status != reversal.PENDING_STATUS_EXPIRED && status != reversal.PENDING_STATUS_REVIEW {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"status": "status must be PENDG, APPLD, EXPRD or REVIW"}))
+	}
+
+	// get limit parameter
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(ADMIN_PARKED_DEFAULT_LIMIT)))
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"limit": "limit must be a positive number"}))
+	}
+
+	// get parked reversals
+	parked, err := reversal.GetByStatus(status, limit)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(parked))
+}
+
+
+// Get the lifecycle of an authorization by the tx-id of
+// the authorization or a message of it
+func AdminAuthorizationHandler(c *fiber.Ctx) error {
+
+	// get authorization
+	auth, err := lifecycle.Get(c.Params("txid"))
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+	if auth == nil {
+		return c.Status(fiber.StatusNotFound).JSON(jsend.NewFail(map[string]string{"txid": "authorization not found"}))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(auth))
+}
+
+
+// Get the wallets carrying debt
+func AdminDebtWalletsHandler(c *fiber.Ctx) error {
+
+	// get limit parameter
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(ADMIN_DEBT_DEFAULT_LIMIT)))
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"limit": "limit must be a positive number"}))
+	}
+
+	// get wallets
+	wallets, err := wallet.GetDebtWallets(limit)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(wallets))
+}
+
+
+// Get the wallet spending limits and the day and month usage, the
+// card ATM usage is for the card id in cardid
+func AdminWalletLimitsHandler(c *fiber.Ctx) error {
+
+	// get limits
+	limits, err := wallet.GetLimits(c.Params("walletid"), c.Query("cardid"), commons.LIMIT_TX_TYPES)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+	if limits == nil {
+		return c.Status(fiber.StatusNotFound).JSON(jsend.NewFail(map[string]string{"walletid": "wallet not found"}))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(limits))
+}
+
+
+// Get the MCC rules, filtered by scope and scope id
+func AdminMCCRulesHandler(c *fiber.Ctx) error {
+
+	// get scope parameters
+	scopeType := c.Query("scope")
+	if scopeType != "" && !mcc.IsScope(scopeType) {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"scope": "scope must be PROGR, GROUP or WALLE"}))
+	}
+	scopeID := c.Query("scope-id")
+	if scopeID != "" && scopeType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"scope": "scope is required with scope-id"}))
+	}
+
+	// get rules
+	rules, err := mcc.GetRules(scopeType, scopeID)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(rules))
+}
+
+
+// Add a MCC rule to the allow or deny list of a program, group or wallet
+func AdminAddMCCRuleHandler(c *fiber.Ctx) error {
+
+	// get rule
+	var ruleReq MCCRuleReqJSON
+	err := c.BodyParser(&ruleReq)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"body": "body must be a json mcc rule"}))
+	}
+
+	// check rule
+	if !mcc.IsScope(ruleReq.ScopeType) {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"scope_type": "scope_type must be PROGR, GROUP or WALLE"}))
+	}
+	if ruleReq.ScopeId == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"scope_id": "scope_id cannot be empty"}))
+	}
+	if !mcc.IsMCC(ruleReq.MCC) {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"mcc": "mcc must be a four digits code"}))
+	}
+	if !mcc.IsRuleType(ruleReq.RuleType) {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"rule_type": "rule_type must be ALLOW or DENY"}))
+	}
+
+	// add rule
+	ruleID, err := mcc.AddRule(ruleReq.ScopeType, ruleReq.ScopeId, ruleReq.MCC, ruleReq.RuleType)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+	logger.LogInfo(fmt.Sprintf("%s - mcc rule rule_id=%s %s %s=%s mcc=%s added", helpers.GetFunctionName(), ruleID,
+					ruleReq.RuleType, ruleReq.ScopeType, ruleReq.ScopeId, ruleReq.MCC))
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(map[string]string{"rule_id": ruleID}))
+}
+
+
+// Delete a MCC rule
+func AdminDeleteMCCRuleHandler(c *fiber.Ctx) error {
+
+	// delete rule
+	deleted, err := mcc.DeleteRule(c.Params("ruleid"))
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(jsend.NewFail(map[string]string{"ruleid": "mcc rule not found"}))
+	}
+	logger.LogInfo(fmt.Sprintf("%s - mcc rule rule_id=%s deleted", helpers.GetFunctionName(), c.Params("ruleid")))
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(map[string]string{"rule_id": c.Params("ruleid")}))
+}
+
+
+// Set or replace a card PIN with the clear PIN or the bcrypt hash
+// of the card issuer, the failed tries counter is reset
+func AdminSetCardPINHandler(c *fiber.Ctx) error {
+
+	// get pin
+	var pinReq CardPINReqJSON
+	err := c.BodyParser(&pinReq)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"body": "body must be a json card pin"}))
+	}
+
+	// check pin, only one of pin and pin_hash
+	if (pinReq.PIN == "") == (pinReq.PINHash == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"pin": "one of pin or pin_hash is required"}))
+	}
+	if pinReq.PIN != "" && !card.IsPIN(pinReq.PIN) {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"pin": "pin must have from 4 to 12 digits"}))
+	}
+	if pinReq.PINHash != "" && !card.IsPINHash(pinReq.PINHash) {
+		return c.Status(fiber.StatusBadRequest).JSON(jsend.NewFail(map[string]string{"pin_hash": "pin_hash must be a bcrypt hash"}))
+	}
+
+	// set pin
+	if pinReq.PIN != "" {
+		err = card.SetPIN(c.Params("cardid"), pinReq.PIN)
+	} else {
+		err = card.SetPINHash(c.Params("cardid"), pinReq.PINHash)
+	}
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(jsend.NewError(err.Error(), fiber.StatusInternalServerError, nil))
+	}
+	logger.LogInfo(fmt.Sprintf("%s - card_id=%s pin set", helpers.GetFunctionName(), c.Params("cardid")))
+
+	// Send success response
+	return c.Status(fiber.StatusOK).JSON(jsend.New(map[string]string{"card_id": c.Params("cardid")}))
+}
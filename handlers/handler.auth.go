@@ -0,0 +1,38 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package contains the admin routes handlers
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"clevergo.tech/jsend"
+	"github.com/gofiber/fiber/v2"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+)
+
+const AUTH_BEARER_PREFIX = "Bearer "
+
+
+// Authenticates the admin requests with the admin API bearer token,
+// every request is rejected when the token is not configured
+func AdminAuthHandler(c *fiber.Ctx) error {
+
+	// get bearer token
+	auth := c.Get(fiber.HeaderAuthorization)
+	token := strings.TrimPrefix(auth, AUTH_BEARER_PREFIX)
+
+	// check token
+	if configs.AdminAPIToken == "" || token == "" || token == auth ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(configs.AdminAPIToken)) != 1 {
+		logger.LogWarning(fmt.Sprintf("%s - unauthorized admin request method=%s path=%s ip=%s",
+			helpers.GetFunctionName(), c.Method(), c.Path(), c.IP()))
+		return c.Status(fiber.StatusUnauthorized).JSON(jsend.NewFail(map[string]string{"authorization": "a valid admin bearer token is required"}))
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,237 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package provides an exact money amount type, an integer
+// number of units of 10^-AMOUNT_SCALE, the largest ISO 4217
+// currency exponent in use.
+//
+// Rounding rules:
+//   1. Paymentology amounts are received in minor units of the
+//      transaction currency and are scaled exactly with the
+//      currency exponent, no rounding is made.
+//   2. Amounts are stored in the database as decimals, values
+//      with more than AMOUNT_SCALE digits are rounded half away
+//      from zero when they are read.
+//   3. Float values (legacy float columns) are rounded half
+//      away from zero to the nearest unit.
+//   4. Sums, differences and comparisons are exact integer
+//      operations, no rounding is made.
+//   5. Amounts converted with an exchange rate or returned in
+//      minor units of a currency are rounded half away from
+//      zero to the currency exponent.
+//
+// Package usage:
+//   1. Parse a Paymentology amount with ParseMinorUnits and
+//      scale it with FromMinorUnits and the currency exponent
+//   2. Use the amounts as SQL parameters and scan destinations,
+//      they are converted to and from decimals
+package helpers
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Amount in units of 10^-AMOUNT_SCALE
+type Amount int64
+
+// Number of decimal digits of the amounts, BHD and KWD use 3
+const AMOUNT_SCALE = 3
+
+
+// Function ParseMinorUnits parses a Paymentology amount, a
+// non negative integer number of minor units
+func ParseMinorUnits(value string) (int64, error) {
+
+	// check digits
+	if value == "" {
+		return 0, fmt.Errorf("amount cannot be empty")
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("amount=%s is not a number of minor units", value)
+		}
+	}
+
+	minor, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount=%s is out of range", value)
+	}
+
+	return minor, nil
+}
+
+
+// Function FromMinorUnits scales an amount in minor units of
+// a currency with the currency exponent
+func FromMinorUnits(minor int64, exponent int) (Amount, error) {
+
+	// check exponent
+	if exponent < 0 || exponent > AMOUNT_SCALE {
+		return 0, fmt.Errorf("currency exponent=%d is not supported", exponent)
+	}
+
+	// scale exactly
+	unit := pow10(AMOUNT_SCALE - exponent)
+	if minor > math.MaxInt64 / unit || minor < math.MinInt64 / unit {
+		return 0, fmt.Errorf("amount=%d is out of range", minor)
+	}
+
+	return Amount(minor * unit), nil
+}
+
+
+// Function MinorUnits gets the amount in minor units of a currency
+// with the currency exponent, rounding half away from zero
+func (a Amount) MinorUnits(exponent int) int64 {
+	if exponent >= AMOUNT_SCALE {
+		return int64(a)
+	}
+	if exponent < 0 {
+		exponent = 0
+	}
+	minor, _ := roundRat(big.NewRat(int64(a), pow10(AMOUNT_SCALE - exponent)))
+	return int64(minor)
+}
+
+
+// Function ParseDecimal parses a decimal amount in major units, as
+// "12.34" or "1234e-2", rounding half away from zero to AMOUNT_SCALE
+func ParseDecimal(value string) (Amount, error) {
+
+	// parse exact decimal value
+	rat, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return 0, fmt.Errorf("amount=%s is not a decimal number", value)
+	}
+
+	// scale to units
+	rat.Mul(rat, new(big.Rat).SetInt64(pow10(AMOUNT_SCALE)))
+
+	units, ok := roundRat(rat)
+	if !ok {
+		return 0, fmt.Errorf("amount=%s is out of range", value)
+	}
+
+	return units, nil
+}
+
+
+// Function Convert converts the amount with an exchange rate, rounding
+// half away from zero to the exponent of the target currency
+func (a Amount) Convert(rate *big.Rat, exponent int) (Amount, error) {
+
+	// check exponent
+	if exponent < 0 || exponent > AMOUNT_SCALE {
+		return 0, fmt.Errorf("currency exponent=%d is not supported", exponent)
+	}
+
+	// convert in minor units of the target currency
+	unit := pow10(AMOUNT_SCALE - exponent)
+	rat := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(a)), rate)
+	rat.Quo(rat, new(big.Rat).SetInt64(unit))
+
+	minor, ok := roundRat(rat)
+	if !ok {
+		return 0, fmt.Errorf("amount=%s converted with rate=%s is out of range", a, rate.FloatString(6))
+	}
+
+	return FromMinorUnits(int64(minor), exponent)
+}
+
+
+// Rounds a rational value half away from zero,
+// returns false when it is out of range
+func roundRat(rat *big.Rat) (Amount, bool) {
+	num, den := new(big.Int).Abs(rat.Num()), rat.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if !quo.IsInt64() {
+		return 0, false
+	}
+	if rat.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return Amount(quo.Int64()), true
+}
+
+
+// Gets 10 to the power of n
+func pow10(n int) int64 {
+	value := int64(1)
+	for i := 0; i < n; i++ {
+		value *= 10
+	}
+	return value
+}
+
+
+// Function FromFloat converts a float amount in major units,
+// rounding half away from zero to the nearest unit
+func FromFloat(value float64) Amount {
+	return Amount(math.Round(value * math.Pow10(AMOUNT_SCALE)))
+}
+
+
+// Function String formats the amount as a decimal in major units
+func (a Amount) String() string {
+	units := int64(a)
+	sign := ""
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	unit := pow10(AMOUNT_SCALE)
+	if AMOUNT_SCALE == 0 {
+		return fmt.Sprintf("%s%d", sign, units)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, units/unit, AMOUNT_SCALE, units%unit)
+}
+
+
+// Function Value converts the amount to a SQL decimal parameter
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+
+// Function Scan reads the amount from a SQL decimal or float value
+func (a *Amount) Scan(src interface{}) error {
+	var err error
+
+	switch value := src.(type) {
+		case nil:
+			*a = 0
+		case int64:
+			*a, err = FromMinorUnits(value, 0)
+		case float64:
+			*a = FromFloat(value)
+		case string:
+			*a, err = ParseDecimal(value)
+		case []byte:
+			*a, err = ParseDecimal(string(value))
+		default:
+			err = fmt.Errorf("cannot scan %T into an amount", src)
+	}
+
+	return err
+}
+
+
+// Function MarshalJSON converts the amount to a JSON decimal number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+
+// Function UnmarshalJSON reads the amount from a JSON decimal number
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var err error
+	*a, err = ParseDecimal(strings.Trim(string(data), `"`))
+	return err
+}
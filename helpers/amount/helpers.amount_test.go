@@ -0,0 +1,330 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package helpers
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// Property tests iterations and seed
+const (
+	PROPERTY_ITERATIONS 	= 10000
+	PROPERTY_SEED 			= 20220601
+)
+
+
+func TestParseMinorUnits(t *testing.T) {
+	tests := []struct {
+		value 		string
+		minor 		int64
+		fails 		bool
+	}{
+		{"0", 0, false},
+		{"1", 1, false},
+		{"000123", 123, false},
+		{"9223372036854775807", math.MaxInt64, false},
+		{"9223372036854775808", 0, true},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"+1", 0, true},
+		{"12.34", 0, true},
+		{"1e3", 0, true},
+		{" 12", 0, true},
+	}
+
+	for _, tt := range tests {
+		minor, err := ParseMinorUnits(tt.value)
+		if (err != nil) != tt.fails {
+			t.Errorf("ParseMinorUnits(%q) error=%v, fails=%t expected", tt.value, err, tt.fails)
+			continue
+		}
+		if minor != tt.minor {
+			t.Errorf("ParseMinorUnits(%q)=%d, %d expected", tt.value, minor, tt.minor)
+		}
+	}
+}
+
+
+func TestFromMinorUnits(t *testing.T) {
+	tests := []struct {
+		minor 		int64
+		exponent 	int
+		amount 		string
+		fails 		bool
+	}{
+		{1234, 0, "1234.000", false},	// JPY
+		{1234, 2, "12.340", false},		// MXN
+		{1234, 3, "1.234", false},		// BHD, KWD
+		{5, 2, "0.050", false},
+		{0, 2, "0.000", false},
+		{-1234, 2, "-12.340", false},
+		{1, 4, "", true},
+		{1, -1, "", true},
+		{math.MaxInt64, 2, "", true},
+		{math.MaxInt64 / 10, 2, "", false},
+		{math.MaxInt64, 3, "9223372036854775.807", false},
+	}
+
+	for _, tt := range tests {
+		amount, err := FromMinorUnits(tt.minor, tt.exponent)
+		if (err != nil) != tt.fails {
+			t.Errorf("FromMinorUnits(%d, %d) error=%v, fails=%t expected", tt.minor, tt.exponent, err, tt.fails)
+			continue
+		}
+		if !tt.fails && tt.amount != "" && amount.String() != tt.amount {
+			t.Errorf("FromMinorUnits(%d, %d)=%s, %s expected", tt.minor, tt.exponent, amount, tt.amount)
+		}
+	}
+}
+
+
+func TestMinorUnitsRounding(t *testing.T) {
+	tests := []struct {
+		amount 		Amount
+		exponent 	int
+		minor 		int64
+	}{
+		{12345, 3, 12345},
+		{12345, 2, 1235},	// 12.345 half away from zero
+		{12344, 2, 1234},
+		{-12345, 2, -1235},
+		{-12344, 2, -1234},
+		{12500, 0, 13},
+		{12499, 0, 12},
+		{-12500, 0, -13},
+		{5, 2, 1},			// 0.005
+		{4, 2, 0},
+		{-5, 2, -1},
+		{12345, 5, 12345},
+		{12345, -1, 12},
+	}
+
+	for _, tt := range tests {
+		minor := tt.amount.MinorUnits(tt.exponent)
+		if minor != tt.minor {
+			t.Errorf("Amount(%s).MinorUnits(%d)=%d, %d expected", tt.amount, tt.exponent, minor, tt.minor)
+		}
+	}
+}
+
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value 		string
+		amount 		Amount
+		fails 		bool
+	}{
+		{"12.34", 12340, false},
+		{"1234e-2", 12340, false},
+		{"0.001", 1, false},
+		{"0.0005", 1, false},		// half away from zero
+		{"0.0004", 0, false},
+		{"-0.0005", -1, false},
+		{"-12.3456", -12346, false},
+		{"12.3454", 12345, false},
+		{" 7 ", 7000, false},
+		{"1/8", 125, false},
+		{"abc", 0, true},
+		{"", 0, true},
+		{"1e30", 0, true},
+	}
+
+	for _, tt := range tests {
+		amount, err := ParseDecimal(tt.value)
+		if (err != nil) != tt.fails {
+			t.Errorf("ParseDecimal(%q) error=%v, fails=%t expected", tt.value, err, tt.fails)
+			continue
+		}
+		if amount != tt.amount {
+			t.Errorf("ParseDecimal(%q)=%d, %d expected", tt.value, amount, tt.amount)
+		}
+	}
+}
+
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount 		Amount
+		rate 		string
+		exponent 	int
+		converted 	Amount
+		fails 		bool
+	}{
+		{10000, "17.0512", 2, 170510, false},	// 10.00 USD to 170.51 MXN
+		{10000, "0.058", 2, 580, false},
+		{12345, "1", 0, 12000, false},			// rounded to JPY
+		{12500, "1", 0, 13000, false},
+		{-12500, "1", 0, -13000, false},
+		{10000, "0.3775", 3, 3775, false},		// to BHD
+		{1, "1", 4, 0, true},
+		{math.MaxInt64, "10", 2, 0, true},
+	}
+
+	for _, tt := range tests {
+		rate, _ := new(big.Rat).SetString(tt.rate)
+		converted, err := tt.amount.Convert(rate, tt.exponent)
+		if (err != nil) != tt.fails {
+			t.Errorf("Amount(%s).Convert(%s, %d) error=%v, fails=%t expected", tt.amount, tt.rate, tt.exponent, err, tt.fails)
+			continue
+		}
+		if converted != tt.converted {
+			t.Errorf("Amount(%s).Convert(%s, %d)=%d, %d expected", tt.amount, tt.rate, tt.exponent, converted, tt.converted)
+		}
+	}
+}
+
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src 		interface{}
+		amount 		Amount
+		fails 		bool
+	}{
+		{nil, 0, false},
+		{int64(12), 12000, false},
+		{"12.345", 12345, false},
+		{[]byte("12.3456"), 12346, false},
+		{12.3455, 12346, false},
+		{0.1 + 0.2, 300, false},
+		{true, 0, true},
+	}
+
+	for _, tt := range tests {
+		var amount Amount
+		err := amount.Scan(tt.src)
+		if (err != nil) != tt.fails {
+			t.Errorf("Scan(%v) error=%v, fails=%t expected", tt.src, err, tt.fails)
+			continue
+		}
+		if amount != tt.amount {
+			t.Errorf("Scan(%v)=%d, %d expected", tt.src, amount, tt.amount)
+		}
+	}
+}
+
+
+func TestJSON(t *testing.T) {
+	values := struct {
+		Amount 		Amount		`json:"amount"`
+	}{Amount: -12345}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		t.Fatalf("Marshal error=%s", err.Error())
+	}
+	if string(data) != `{"amount":-12.345}` {
+		t.Errorf("Marshal=%s", data)
+	}
+
+	values.Amount = 0
+	err = json.Unmarshal(data, &values)
+	if err != nil || values.Amount != -12345 {
+		t.Errorf("Unmarshal=%d error=%v, -12345 expected", values.Amount, err)
+	}
+}
+
+
+// Scaling minor units with a currency exponent and getting
+// them back in the same exponent is exact
+func TestPropertyMinorUnitsRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(PROPERTY_SEED))
+	for i := 0; i < PROPERTY_ITERATIONS; i++ {
+		exponent := r.Intn(AMOUNT_SCALE + 1)
+		minor := r.Int63n(math.MaxInt64 / pow10(AMOUNT_SCALE)) - r.Int63n(math.MaxInt64 / pow10(AMOUNT_SCALE))
+		amount, err := FromMinorUnits(minor, exponent)
+		if err != nil {
+			t.Fatalf("FromMinorUnits(%d, %d) error=%s", minor, exponent, err.Error())
+		}
+		if amount.MinorUnits(exponent) != minor {
+			t.Fatalf("FromMinorUnits(%d, %d).MinorUnits=%d", minor, exponent, amount.MinorUnits(exponent))
+		}
+	}
+}
+
+
+// Formatting an amount and parsing it back is exact
+func TestPropertyStringRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(PROPERTY_SEED))
+	for i := 0; i < PROPERTY_ITERATIONS; i++ {
+		amount := Amount(r.Int63() - r.Int63())
+		parsed, err := ParseDecimal(amount.String())
+		if err != nil || parsed != amount {
+			t.Fatalf("ParseDecimal(%s)=%d error=%v, %d expected", amount, parsed, err, int64(amount))
+		}
+	}
+}
+
+
+// Sums and differences of scaled amounts are exact, the sum of the
+// amounts is the amount of the sum of the minor units
+func TestPropertyAddSub(t *testing.T) {
+	r := rand.New(rand.NewSource(PROPERTY_SEED))
+	for i := 0; i < PROPERTY_ITERATIONS; i++ {
+		exponent := r.Intn(AMOUNT_SCALE + 1)
+		minors := make([]int64, 1 + r.Intn(20))
+		var total Amount
+		var totalMinor int64
+		for j := range minors {
+			minors[j] = r.Int63n(1000000000)
+			amount, _ := FromMinorUnits(minors[j], exponent)
+			total += amount
+			totalMinor += minors[j]
+		}
+
+		// sum
+		expected, _ := FromMinorUnits(totalMinor, exponent)
+		if total != expected {
+			t.Fatalf("sum of %v exponent=%d is %s, %s expected", minors, exponent, total, expected)
+		}
+
+		// difference
+		for j := range minors {
+			amount, _ := FromMinorUnits(minors[j], exponent)
+			total -= amount
+		}
+		if total != 0 {
+			t.Fatalf("difference of %v exponent=%d is %s, 0 expected", minors, exponent, total)
+		}
+
+		// decimal sum
+		sum := new(big.Rat)
+		for j := range minors {
+			amount, _ := FromMinorUnits(minors[j], exponent)
+			rat, _ := new(big.Rat).SetString(amount.String())
+			sum.Add(sum, rat)
+		}
+		parsed, err := ParseDecimal(sum.FloatString(AMOUNT_SCALE))
+		if err != nil || parsed != expected {
+			t.Fatalf("decimal sum of %v exponent=%d is %s, %s expected", minors, exponent, parsed, expected)
+		}
+	}
+}
+
+
+// Rounding to minor units is half away from zero and symmetric
+func TestPropertyRoundingSymmetric(t *testing.T) {
+	r := rand.New(rand.NewSource(PROPERTY_SEED))
+	for i := 0; i < PROPERTY_ITERATIONS; i++ {
+		exponent := r.Intn(AMOUNT_SCALE)
+		amount := Amount(r.Int63n(1000000000))
+		minor := amount.MinorUnits(exponent)
+		if (-amount).MinorUnits(exponent) != -minor {
+			t.Fatalf("Amount(%s).MinorUnits(%d)=%d is not symmetric", amount, exponent, minor)
+		}
+
+		// the rounding error is at most half a minor unit
+		scaled, _ := FromMinorUnits(minor, exponent)
+		diff := int64(scaled - amount)
+		if diff < 0 {
+			diff = -diff
+		}
+		if 2 * diff > pow10(AMOUNT_SCALE - exponent) {
+			t.Fatalf("Amount(%s).MinorUnits(%d)=%d rounding error is over half a minor unit", amount, exponent, minor)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles card entity models
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"golang.org/x/crypto/bcrypt"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+)
+
+// PIN verification results
+const(
+	PIN_RESULT_VALID = "VALID"
+	PIN_RESULT_INCORRECT = "INCORRECT"
+	PIN_RESULT_TRIES_EXCEEDED = "TRIES_EXCEEDED"
+	PIN_RESULT_NOT_SET = "NOT_SET"
+)
+
+// PIN length limits
+const(
+	PIN_MIN_LENGTH = 4
+	PIN_MAX_LENGTH = 12
+)
+
+
+// Checks a clear PIN has from 4 to 12 digits
+func IsPIN(pin string) bool {
+	if len(pin) < PIN_MIN_LENGTH || len(pin) > PIN_MAX_LENGTH {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+
+// Checks a PIN hash is a bcrypt hash
+func IsPINHash(pinHash string) bool {
+	_, err := bcrypt.Cost([]byte(pinHash))
+	return err == nil
+}
+
+
+// Set or replace the PIN of a card, the PIN is stored as a
+// bcrypt hash and the failed tries counter is reset
+func SetPIN(cardID string, pin string) error {
+
+	// check parameters
+	if 	cardID == "" || pin == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", "paramaters cannot be empty")
+	}
+
+	// hash the pin
+	pinHash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return SetPINHash(cardID, string(pinHash))
+}
+
+
+// Set or replace the PIN hash of a card, used to load the bcrypt
+// hashes of the card issuer, the failed tries counter is reset
+func SetPINHash(cardID string, pinHash string) error {
+
+	// check parameters
+	if 	cardID == "" || pinHash == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", "paramaters cannot be empty")
+	}
+	if !IsPINHash(pinHash) {
+		return fmt.Errorf(helpers.GetFunctionName() + "- card_id=%s pin hash is not a bcrypt hash", cardID)
+	}
+
+	// insert or replace the card pin
+	_, err := db.DBWrite.Exec(context.Background(),
+		`INSERT INTO card_pin(card_id, pin_hash, failed_tries, created_at, updated_at)
+		VALUES ($1, $2, 0, NOW(), NOW())
+		ON CONFLICT (card_id) DO UPDATE SET pin_hash = EXCLUDED.pin_hash, failed_tries = 0, updated_at = NOW()`,
+		cardID, pinHash)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return nil
+}
+
+
+// Verify a card PIN against the stored hash and update the
+// failed tries counter. Returns one of the PIN_RESULT values.
+func VerifyPIN(cardID string, pin string, maxTries int) (string, error) {
+	var pinHash string
+	var failedTries int
+
+	// check parameters
+	if 	cardID == "" || pin == "" {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", "paramaters cannot be empty")
+	}
+
+	// begin database transaction
+	ctx := context.Background()
+	tx, err := db.DBWrite.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// lock card pin row for update
+	row := tx.QueryRow(ctx, "SELECT pin_hash, failed_tries FROM card_pin WHERE card_id = $1 FOR UPDATE", cardID)
+	err = row.Scan(&pinHash, &failedTries)
+	if err == pgx.ErrNoRows {
+		tx.Rollback(ctx)
+		return PIN_RESULT_NOT_SET, nil
+	}
+	if err != nil {
+		tx.Rollback(ctx)
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// check the failed tries counter before comparing
+	if failedTries >= maxTries {
+		tx.Rollback(ctx)
+		return PIN_RESULT_TRIES_EXCEEDED, nil
+	}
+
+	// compare pin and update the failed tries counter
+	result := PIN_RESULT_VALID
+	if bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(pin)) != nil {
+		failedTries += 1
+		result = PIN_RESULT_INCORRECT
+		if failedTries >= maxTries {
+			result = PIN_RESULT_TRIES_EXCEEDED
+		}
+	} else {
+		failedTries = 0
+	}
+	ct, err := tx.Exec(ctx, "UPDATE card_pin SET failed_tries = $1, updated_at = NOW() WHERE card_id = $2",
+			failedTries, cardID)
+	if err != nil || ct.String() != "UPDATE 1" {
+		tx.Rollback(ctx)
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- error updating card_pin card_id=%s", cardID)
+	}
+
+	// commit database transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return result, nil
+}
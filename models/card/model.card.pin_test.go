@@ -0,0 +1,54 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package models
+
+import (
+	"testing"
+	"golang.org/x/crypto/bcrypt"
+)
+
+
+func TestIsPIN(t *testing.T) {
+	tests := []struct {
+		pin 		string
+		valid 		bool
+	}{
+		{"1234", true},
+		{"123456789012", true},
+		{"123", false},
+		{"1234567890123", false},
+		{"12a4", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if IsPIN(tt.pin) != tt.valid {
+			t.Errorf("IsPIN(%q)=%t, %t expected", tt.pin, !tt.valid, tt.valid)
+		}
+	}
+}
+
+
+func TestIsPINHash(t *testing.T) {
+	pinHash, err := bcrypt.GenerateFromPassword([]byte("1234"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword error=%s", err.Error())
+	}
+
+	tests := []struct {
+		pinHash 	string
+		valid 		bool
+	}{
+		{string(pinHash), true},
+		{"1234", false},
+		{"", false},
+		{"$2a$10$short", false},
+	}
+
+	for _, tt := range tests {
+		if IsPINHash(tt.pinHash) != tt.valid {
+			t.Errorf("IsPINHash(%q)=%t, %t expected", tt.pinHash, !tt.valid, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the authorization lifecycle models, every
+// authorization keeps its current state and the transitions
+// made by the messages that reference it
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+)
+
+// general constants
+const(
+	PSQL_MSG_INSERT_1 = "INSERT 0 1"
+	PSQL_MSG_UPDATE_1 = "UPDATE 1"
+	MSG_EMPTY_PARAMETERS = "paramaters cannot be empty"
+)
+
+// Authorization struct
+type Authorization struct {
+	TxID 					string				`json:"tx_id"`
+	WalletId  				string				`json:"wallet_id"`
+	TypeId 					string				`json:"transaction_type_id"`
+	StateId 				string				`json:"state_id"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+	UpdatedAt 				pgtype.Timestamp	`json:"updated_at"`
+	Transitions 			[]Transition		`json:"transitions"`
+}
+
+// Authorization transition struct
+type Transition struct {
+	AuthorizationTxID 		string				`json:"authorization_tx_id"`
+	TxID 					string				`json:"tx_id"`
+	FromState 				string				`json:"from_state"`
+	ToState 				string				`json:"to_state"`
+	Valid 					bool				`json:"valid"`
+	Repeated 				bool				`json:"-"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+}
+
+// Function type that checks if a transition is allowed
+type AllowedFunc func(fromState string, toState string) bool
+
+
+// Function Start starts the lifecycle of an authorization
+func Start(walletID string, txID string, state string) error {
+
+	// check parameters
+	if 	walletID == "" || txID == "" || state == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// insert authorization
+	_, err := db.DBWrite.Exec(context.Background(),
+		`INSERT INTO pmtol_authorization(tx_id, wallet_id, transaction_type_id, state_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $3, NOW(), NOW())
+		ON CONFLICT (tx_id) DO NOTHING`,
+		txID, walletID, state)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return nil
+}
+
+
+// Function MakeTransition makes the transition of a message to a state on
+// the authorization of the referenced tx-id in its own database transaction,
+// see MakeTransitionTx.
+func MakeTransition(walletID string, referenceID string, txID string, toState string,
+	initialState string, allowed AllowedFunc) (*Transition, error) {
+
+	// begin database transaction
+	ctx := context.Background()
+	tx, err := db.DBWrite.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// make transition
+	trn, err := MakeTransitionTx(ctx, tx, walletID, referenceID, txID, toState, initialState, allowed)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	// commit database transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return trn, nil
+}
+
+
+// Function MakeTransitionTx makes the transition of a message to a state on
+// the authorization of the referenced tx-id, the referenced tx-id is the
+// authorization or a message of it. An authorization not found is started
+// in the initial state. Invalid transitions are recorded and do not change
+// the state, a transition already recorded for the message is repeated.
+// The transition is made in the database transaction of the caller, so it
+// is committed or rolled back with the balances it allows to change.
+func MakeTransitionTx(ctx context.Context, tx pgx.Tx, walletID string, referenceID string, txID string,
+	toState string, initialState string, allowed AllowedFunc) (*Transition, error) {
+
+	// check parameters
+	if 	walletID == "" || referenceID == "" || txID == "" || toState == "" || initialState == "" {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// get the authorization tx-id
+	authTxID, err := resolveAuthorization(ctx, tx, referenceID)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if authTxID == "" {
+		authTxID = referenceID
+		_, err = tx.Exec(ctx,
+			`INSERT INTO pmtol_authorization(tx_id, wallet_id, transaction_type_id, state_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $3, NOW(), NOW())
+			ON CONFLICT (tx_id) DO NOTHING`,
+			authTxID, walletID, initialState)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+	}
+
+	// lock authorization for update
+	trn := &Transition{AuthorizationTxID: authTxID, TxID: txID, ToState: toState}
+	row := tx.QueryRow(ctx, "SELECT state_id FROM pmtol_authorization WHERE tx_id = $1 FOR UPDATE", authTxID)
+	err = row.Scan(&trn.FromState)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// check for a transition already recorded
+	row = tx.QueryRow(ctx,
+		`SELECT from_state, valid, created_at FROM pmtol_authorization_transition
+		WHERE authorization_tx_id = $1 AND tx_id = $2 AND to_state = $3`,
+		authTxID, txID, toState)
+	err = row.Scan(&trn.FromState, &trn.Valid, &trn.CreatedAt)
+	if err == nil {
+		trn.Repeated = true
+		return trn, nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// record transition
+	trn.Valid = allowed(trn.FromState, toState)
+	tct, err := tx.Exec(ctx,
+		`INSERT INTO pmtol_authorization_transition(authorization_tx_id, tx_id, from_state, to_state, valid, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())`,
+		authTxID, txID, trn.FromState, toState, trn.Valid)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if tct.String() != PSQL_MSG_INSERT_1 {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- pmtol_authorization_transition tx_id=%s not inserted", txID)
+	}
+
+	// update authorization state
+	if trn.Valid {
+		tct, err = tx.Exec(ctx,
+			"UPDATE pmtol_authorization SET state_id = $1, updated_at = NOW() WHERE tx_id = $2",
+			toState, authTxID)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		if tct.String() != PSQL_MSG_UPDATE_1 {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- pmtol_authorization tx_id=%s not updated", authTxID)
+		}
+	}
+
+	return trn, nil
+}
+
+
+// Function Get gets an authorization and its transitions by the
+// authorization tx-id or the tx-id of a message of it
+func Get(txID string) (*Authorization, error) {
+	ctx := context.Background()
+
+	// begin read only database transaction
+	tx, err := db.DBRead.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	// get the authorization tx-id
+	authTxID, err := resolveAuthorization(ctx, tx, txID)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if authTxID == "" {
+		return nil, nil
+	}
+
+	// get authorization
+	auth := new(Authorization)
+	row := tx.QueryRow(ctx,
+		`SELECT tx_id, wallet_id, transaction_type_id, state_id, created_at, updated_at
+		FROM 	pmtol_authorization
+		WHERE	tx_id = $1`, authTxID)
+	err = row.Scan(&auth.TxID, &auth.WalletId, &auth.TypeId, &auth.StateId, &auth.CreatedAt, &auth.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// get transitions
+	rows, err := tx.Query(ctx,
+		`SELECT authorization_tx_id, tx_id, from_state, to_state, valid, created_at
+		FROM 	pmtol_authorization_transition
+		WHERE	authorization_tx_id = $1
+		ORDER BY created_at`, authTxID)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	auth.Transitions = make([]Transition, 0)
+	for rows.Next() {
+		var trn Transition
+		err = rows.Scan(&trn.AuthorizationTxID, &trn.TxID, &trn.FromState, &trn.ToState, &trn.Valid, &trn.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		auth.Transitions = append(auth.Transitions, trn)
+	}
+
+	return auth, nil
+}
+
+
+// Gets the authorization tx-id of a tx-id, the tx-id is the
+// authorization or a message with a valid transition on it.
+// Returns an empty tx-id when it is not found
+func resolveAuthorization(ctx context.Context, tx pgx.Tx, txID string) (string, error) {
+	var authTxID string
+
+	row := tx.QueryRow(ctx,
+		`SELECT tx_id FROM pmtol_authorization WHERE tx_id = $1
+		UNION
+		SELECT authorization_tx_id FROM pmtol_authorization_transition WHERE tx_id = $1 AND valid = TRUE
+		LIMIT 1`, txID)
+	err := row.Scan(&authTxID)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return authTxID, nil
+}
@@ -0,0 +1,232 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the merchant category code (MCC) rules models,
+// allow and deny lists at the program, group and wallet level
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+)
+
+// Rule scopes, a program is a Paymentology terminal id
+const (
+	MCC_SCOPE_PROGRAM 		= "PROGR"
+	MCC_SCOPE_GROUP 		= "GROUP"
+	MCC_SCOPE_WALLET 		= "WALLE"
+)
+
+// Rule types
+const (
+	MCC_RULE_ALLOW 			= "ALLOW"
+	MCC_RULE_DENY 			= "DENY"
+)
+
+// general constants
+const(
+	PSQL_MSG_DELETE_1 = "DELETE 1"
+	MSG_EMPTY_PARAMETERS = "paramaters cannot be empty"
+)
+
+// Scopes in evaluation order with their names
+var MCC_SCOPES = []string{MCC_SCOPE_PROGRAM, MCC_SCOPE_GROUP, MCC_SCOPE_WALLET}
+var mccScopeNames = map[string]string{
+	MCC_SCOPE_PROGRAM: 	"program",
+	MCC_SCOPE_GROUP: 	"group",
+	MCC_SCOPE_WALLET: 	"wallet",
+}
+
+// MCC rule struct
+type MCCRule struct {
+	RuleId  				string				`json:"rule_id"`
+	ScopeType 				string				`json:"scope_type"`
+	ScopeId 				string				`json:"scope_id"`
+	MCC 					string				`json:"mcc"`
+	RuleType 				string				`json:"rule_type"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+}
+
+// MCC rules that apply to a wallet
+type WalletMCCRules struct {
+	Rules 					[]MCCRule
+}
+
+// MCC rules columns
+const ruleColumns = `rule_id, scope_type, scope_id, mcc, rule_type, created_at`
+
+
+// Function IsScope checks if a value is a rule scope
+func IsScope(scopeType string) bool {
+	_, ok := mccScopeNames[scopeType]
+	return ok
+}
+
+
+// Function IsRuleType checks if a value is a rule type
+func IsRuleType(ruleType string) bool {
+	return ruleType == MCC_RULE_ALLOW || ruleType == MCC_RULE_DENY
+}
+
+
+// Function IsMCC checks if a value is a four digits merchant category code
+func IsMCC(mcc string) bool {
+	if len(mcc) != 4 {
+		return false
+	}
+	for _, c := range mcc {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+
+// Function Declines checks a merchant category code against the rules,
+// a deny list at any level declines it and every level with an allow
+// list must allow it. A missing code is declined only by allow lists.
+// Returns the decline reason or an empty string when it is allowed
+func (r *WalletMCCRules) Declines(mcc string) string {
+	for _, scopeType := range MCC_SCOPES {
+		hasAllow, allowed := false, false
+		for _, rule := range r.Rules {
+			if rule.ScopeType != scopeType {
+				continue
+			}
+			if rule.RuleType == MCC_RULE_DENY && mcc != "" && rule.MCC == mcc {
+				return fmt.Sprintf("MCC %s in the %s deny list", mcc, mccScopeNames[scopeType])
+			}
+			if rule.RuleType == MCC_RULE_ALLOW {
+				hasAllow = true
+				allowed = allowed || (mcc != "" && rule.MCC == mcc)
+			}
+		}
+		if hasAllow && !allowed {
+			if mcc == "" {
+				return fmt.Sprintf("MCC missing, %s allow list", mccScopeNames[scopeType])
+			}
+			return fmt.Sprintf("MCC %s not in the %s allow list", mcc, mccScopeNames[scopeType])
+		}
+	}
+	return ""
+}
+
+
+// Function GetWalletRules gets the MCC rules of the program,
+// the group and the wallet of a transaction
+func GetWalletRules(programID string, groupID string, walletID string) (*WalletMCCRules, error) {
+
+	// check parameters
+	if 	walletID == "" {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// get the rules
+	rules, err := queryRules(`SELECT ` + ruleColumns + `
+		FROM 	pmtol_mcc_rule
+		WHERE	(scope_type = $1 AND scope_id = $2)
+		OR 		(scope_type = $3 AND scope_id = $4)
+		OR 		(scope_type = $5 AND scope_id = $6)`,
+		MCC_SCOPE_PROGRAM, programID, MCC_SCOPE_GROUP, groupID, MCC_SCOPE_WALLET, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WalletMCCRules{Rules: rules}, nil
+}
+
+
+// Function GetRules gets the MCC rules, filtered by scope
+// when scopeType and scopeID are not empty
+func GetRules(scopeType string, scopeID string) ([]MCCRule, error) {
+
+	// build query
+	qry := `SELECT ` + ruleColumns + `
+		FROM 	pmtol_mcc_rule`
+	args := []interface{}{}
+	if scopeType != "" {
+		qry += ` WHERE scope_type = $1`
+		args = append(args, scopeType)
+		if scopeID != "" {
+			qry += ` AND scope_id = $2`
+			args = append(args, scopeID)
+		}
+	}
+	qry += ` ORDER BY scope_type, scope_id, rule_type, mcc`
+
+	return queryRules(qry, args...)
+}
+
+
+// Function AddRule adds a MCC rule, a rule is added once by
+// scope, code and type. Returns the rule id
+func AddRule(scopeType string, scopeID string, mcc string, ruleType string) (string, error) {
+
+	// check parameters
+	if 	scopeType == "" || scopeID == "" || mcc == "" || ruleType == "" {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// insert rule or get the existing one
+	var ruleID string
+	err := db.DBWrite.QueryRow(context.Background(),
+		`INSERT INTO pmtol_mcc_rule(rule_id, scope_type, scope_id, mcc, rule_type, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (scope_type, scope_id, mcc, rule_type) DO UPDATE SET rule_type = EXCLUDED.rule_type
+		RETURNING rule_id`,
+		uuid.New().String(), scopeType, scopeID, mcc, ruleType).Scan(&ruleID)
+	if err != nil {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return ruleID, nil
+}
+
+
+// Function DeleteRule deletes a MCC rule, returns false when it is not found
+func DeleteRule(ruleID string) (bool, error) {
+
+	// check parameters
+	if 	ruleID == "" {
+		return false, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// delete rule
+	ctag, err := db.DBWrite.Exec(context.Background(),
+		`DELETE FROM pmtol_mcc_rule WHERE rule_id = $1`, ruleID)
+	if err != nil {
+		return false, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return ctag.String() == PSQL_MSG_DELETE_1, nil
+}
+
+
+// Queries the MCC rules
+func queryRules(qry string, args ...interface{}) ([]MCCRule, error) {
+
+	// get the rules
+	rows, err := db.DBRead.Query(context.Background(), qry, args...)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// get values
+	rules := make([]MCCRule, 0)
+	for rows.Next() {
+		var rule MCCRule
+		err = rows.Scan(&rule.RuleId, &rule.ScopeType, &rule.ScopeId, &rule.MCC, &rule.RuleType, &rule.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -25,6 +25,13 @@ type KLV struct {
 	KeyDescrp string
 }
 
+// pmtol_currency table struct, ISO 4217 currencies
+type Currency struct {
+	NumericCode string
+	AlphaCode   string
+	Exponent    int
+}
+
 
 // Builds the database schema
 func memdbCreateSchema() *memdb.DBSchema {
@@ -52,6 +59,22 @@ func memdbCreateSchema() *memdb.DBSchema {
 					},
 				},
 			},
+			// pmtol_currency structure
+			"pmtol_currency": {
+				Name: "pmtol_currency",
+				Indexes: map[string]*memdb.IndexSchema{
+					"id": {
+						Name:    "id",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "NumericCode"},
+					},
+					"alphacode": {
+						Name:    "alphacode",
+						Unique:  true,
+						Indexer: &memdb.StringFieldIndex{Field: "AlphaCode"},
+					},
+				},
+			},
 		},
 	}
 
@@ -105,6 +128,55 @@ func loadKLVmap() (int64, int64, error) {
 }
 
 
+// Loads the pmtol_currency table
+func loadCurrencies() (int64, int64, error) {
+	var dbRecords, memRecords int64 = 0, 0
+	var err error
+
+	// get the total number of records
+	row := db.DBRead.QueryRow(context.Background(), "SELECT count(numeric_code) FROM pmtol_currency")
+	err = row.Scan(&dbRecords)
+	if dbRecords <= 0 {
+		return dbRecords, 0, err
+	}
+
+	// get records from the database
+	rows, err := db.DBRead.Query(context.Background(), "SELECT numeric_code, alpha_code, exponent FROM pmtol_currency ORDER BY numeric_code")
+	if err != nil {
+		return dbRecords, memRecords, err
+	}
+	defer rows.Close()
+
+	// insert records in the memory database
+	var currency Currency
+
+	// create a write transaction
+	txn := imDB.Txn(true)
+
+	for rows.Next() {
+
+		err = rows.Scan(&currency.NumericCode, &currency.AlphaCode, &currency.Exponent)
+		if err != nil {
+			txn.Abort()
+			return dbRecords, memRecords, err
+		}
+
+		err = txn.Insert("pmtol_currency", currency)
+		if err != nil {
+			txn.Abort()
+			return dbRecords, memRecords, err
+		}
+
+		memRecords += 1
+	}
+
+	// commit transaction
+	txn.Commit()
+
+	return dbRecords, memRecords, nil
+}
+
+
 // Loads the schema tables
 func Load() error {
 	var err error
@@ -134,6 +206,24 @@ func Load() error {
 	// Table loaded ok
 	logger.LogInfo(fmt.Sprintf(COMPONENT_NAME+"pmtol_klvmap memory table loaded with %d records of %d", memdbTotalRecords, dbTotalRecords))
 
+	// load pmtol_currency table
+	dbTotalRecords, memdbTotalRecords, err = loadCurrencies()
+	// Check for errors
+	if err != nil {
+		return err
+	}
+
+	// Check loaded records, amounts cannot be scaled without currencies
+	if dbTotalRecords <= 0 {
+		return fmt.Errorf(COMPONENT_NAME + "pmtol_currency table is empty")
+	}
+	if dbTotalRecords > memdbTotalRecords {
+		return fmt.Errorf(COMPONENT_NAME + "pmtol_currency memory table loaded with fewer database records")
+	}
+
+	// Table loaded ok
+	logger.LogInfo(fmt.Sprintf(COMPONENT_NAME+"pmtol_currency memory table loaded with %d records of %d", memdbTotalRecords, dbTotalRecords))
+
 	return nil
 }
 
@@ -158,6 +248,24 @@ func GetFirstByIndex(table string, id string) (interface{}, error) {
 }
 
 
+// Function IsKLVName checks if a KLV key name
+// is in the pmtol_klvmap table
+func IsKLVName(keyName string) (bool, error) {
+
+	// Create read-only transaction
+	txn := imDB.Txn(false)
+	defer txn.Abort()
+
+	// Lookup by key name
+	row, err := txn.First("pmtol_klvmap", "keyname", keyName)
+	if err != nil {
+		return false, err
+	}
+
+	return row != nil, nil
+}
+
+
 // Function GetAll gets all the records from the
 // table parameter value
 func GetAll(table string) ([]interface{}, error) {
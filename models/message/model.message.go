@@ -0,0 +1,93 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles Paymentology administrative message models
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+)
+
+// general constants
+const(
+	PSQL_MSG_INSERT_1 = "INSERT 0 1"
+	MSG_EMPTY_PARAMETERS = "paramaters cannot be empty"
+	MSG_TXDATA_NOT_JSON = "txData is not json"
+)
+
+// Administrative message struct
+type AdminMessage struct {
+	MessageId  				string				`json:"message_id"`
+	Reference  				string				`json:"reference"`
+	MessageType 			string				`json:"message_type"`
+	Message 				string				`json:"message"`
+	TxID 					string				`json:"tx_id"`
+	TxDate 					string				`json:"tx_date"`
+	Data 					pgtype.JSON			`json:"transaction_data"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+}
+
+
+// Insert an administrative message in the message log
+func PostAdminMessage(reference string, messageType string, message string,
+					txID string, txDate string, txData string) (string, error) {
+
+	// check parameters
+	if 	txID == "" || txData == "" {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+	if !helpers.IsJSON(txData) {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
+	}
+
+	// insert administrative message
+	msgID := uuid.New().String()
+	ctag, err := db.DBWrite.Exec(context.Background(),
+		`INSERT INTO pmtol_admin_message(message_id, reference, message_type, message,
+		tx_id, tx_date, transaction_data, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())`,
+		msgID, reference, messageType, message, txID, txDate, txData)
+	if err != nil {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if ctag.String() != PSQL_MSG_INSERT_1 {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- message tx-id=%s not inserted", txID)
+	}
+
+	return msgID, nil
+}
+
+
+// Get the latest administrative messages
+func GetAdminMessages(limit int) ([]AdminMessage, error) {
+
+	// get the messages
+	rows, err := db.DBRead.Query(context.Background(),
+		`SELECT message_id, reference, message_type, message, tx_id, tx_date, transaction_data, created_at
+		FROM 	pmtol_admin_message
+		ORDER BY created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// get values
+	messages := make([]AdminMessage, 0)
+	for rows.Next() {
+		var msg AdminMessage
+		err = rows.Scan(&msg.MessageId, &msg.Reference, &msg.MessageType, &msg.Message,
+					&msg.TxID, &msg.TxDate, &msg.Data, &msg.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,193 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the Paymentology processed requests models,
+// a request is identified by its terminal id, method name and tx-id.
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgtype"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+)
+
+// general constants
+const(
+	PSQL_MSG_UPDATE_1 = "UPDATE 1"
+	MSG_EMPTY_PARAMETERS = "paramaters cannot be empty"
+)
+
+// Processed request struct
+type Request struct {
+	TerminalID 				string				`json:"terminal_id"`
+	MethodName 				string				`json:"method_name"`
+	TxID 					string				`json:"tx_id"`
+	ResultCode 				pgtype.Varchar		`json:"result_code"`
+	Retries 				int					`json:"retries"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+	CompletedAt 			pgtype.Timestamp	`json:"completed_at"`
+	LastRetryAt 			pgtype.Timestamp	`json:"last_retry_at"`
+}
+
+
+// Function Reserve reserves a request before it is processed, the
+// pmtol_request primary key (terminal_id, method_name, tx_id) allows
+// one request per terminal, method and tx-id. When the request was already reserved
+// counts the retry and returns false and the stored result code,
+// the result code is empty while the first request is still in process.
+func Reserve(terminalID string, methodName string, txID string) (bool, string, error) {
+
+	// check parameters
+	if 	terminalID == "" || methodName == "" || txID == "" {
+		return false, "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// insert request or count the retry
+	var retries int
+	var resultCode pgtype.Varchar
+	row := db.DBWrite.QueryRow(context.Background(),
+		`INSERT INTO pmtol_request(terminal_id, method_name, tx_id, retries, created_at)
+		VALUES ($1, $2, $3, 0, NOW())
+		ON CONFLICT (terminal_id, method_name, tx_id) 
+		DO UPDATE SET retries = pmtol_request.retries + 1, last_retry_at = NOW()
+		RETURNING retries, result_code`,
+		terminalID, methodName, txID)
+	err := row.Scan(&retries, &resultCode)
+	if err != nil {
+		return false, "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return retries == 0, resultCode.String, nil
+}
+
+
+// Function Complete stores the result code of a reserved request
+func Complete(terminalID string, methodName string, txID string, resultCode string) error {
+
+	// check parameters
+	if 	terminalID == "" || methodName == "" || txID == "" || resultCode == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// update request
+	ctag, err := db.DBWrite.Exec(context.Background(),
+		`UPDATE pmtol_request SET result_code = $4, completed_at = NOW()
+		WHERE terminal_id = $1 AND method_name = $2 AND tx_id = $3`,
+		terminalID, methodName, txID, resultCode)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if ctag.String() != PSQL_MSG_UPDATE_1 {
+		return fmt.Errorf(helpers.GetFunctionName() + "- request method=%s tx-id=%s not updated", methodName, txID)
+	}
+
+	return nil
+}
+
+
+// Function Release deletes a reserved request without result
+// code, so the request can be processed again
+func Release(terminalID string, methodName string, txID string) error {
+
+	// delete request
+	_, err := db.DBWrite.Exec(context.Background(),
+		`DELETE FROM pmtol_request WHERE terminal_id = $1 AND method_name = $2 AND tx_id = $3 AND result_code IS NULL`,
+		terminalID, methodName, txID)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return nil
+}
+
+
+// Function SaveResponse stores the result code and the exact
+// response sent for a request, the first response stored is
+// kept and it is never overwritten by a later one
+func SaveResponse(terminalID string, methodName string, txID string, resultCode string, response string) error {
+
+	// check parameters
+	if 	terminalID == "" || methodName == "" || txID == "" || resultCode == "" || response == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// insert request or update a reserved request without response
+	_, err := db.DBWrite.Exec(context.Background(),
+		`INSERT INTO pmtol_request(terminal_id, method_name, tx_id, result_code, response_body, retries, created_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, 0, NOW(), NOW())
+		ON CONFLICT (terminal_id, method_name, tx_id) 
+		DO UPDATE SET result_code = EXCLUDED.result_code, response_body = EXCLUDED.response_body, completed_at = NOW()
+		WHERE pmtol_request.response_body IS NULL`,
+		terminalID, methodName, txID, resultCode, response)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return nil
+}
+
+
+// Function GetResponse gets the stored response of a retried
+// request of the same terminal and counts the retry, returns false
+// when the request has no stored response
+func GetResponse(terminalID string, methodName string, txID string) (string, bool, error) {
+
+	// count the retry and get the response
+	rows, err := db.DBWrite.Query(context.Background(),
+		`UPDATE pmtol_request SET retries = retries + 1, last_retry_at = NOW()
+		WHERE terminal_id = $1 AND method_name = $2 AND tx_id = $3 AND response_body IS NOT NULL
+		RETURNING response_body`,
+		terminalID, methodName, txID)
+	if err != nil {
+		return "", false, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// check for results
+	if !rows.Next() {
+		// no rows
+		return "", false, rows.Err()
+	}
+
+	// get values
+	var response string
+	err = rows.Scan(&response)
+	if err != nil {
+		return "", false, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return response, true, nil
+}
+
+
+// Function GetRetriedRequests gets the latest retried requests
+func GetRetriedRequests(limit int) ([]Request, error) {
+
+	// get the requests
+	rows, err := db.DBRead.Query(context.Background(),
+		`SELECT terminal_id, method_name, tx_id, result_code, retries, created_at, completed_at, last_retry_at
+		FROM 	pmtol_request
+		WHERE	retries > 0
+		ORDER BY last_retry_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// get values
+	requests := make([]Request, 0)
+	for rows.Next() {
+		var req Request
+		err = rows.Scan(&req.TerminalID, &req.MethodName, &req.TxID, &req.ResultCode, &req.Retries,
+					&req.CreatedAt, &req.CompletedAt, &req.LastRetryAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
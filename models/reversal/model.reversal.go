@@ -0,0 +1,184 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the pending reversals models, reversals received
+// before their original transaction are parked until it is recorded
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+)
+
+// Pending reversal status
+const (
+	PENDING_STATUS_PENDING 	= "PENDG"
+	PENDING_STATUS_APPLIED 	= "APPLD"
+	PENDING_STATUS_EXPIRED 	= "EXPRD"
+	PENDING_STATUS_REVIEW 	= "REVIW"		// rejected by the authorization lifecycle
+)
+
+// general constants
+const(
+	PSQL_MSG_UPDATE_1 = "UPDATE 1"
+	MSG_EMPTY_PARAMETERS = "paramaters cannot be empty"
+	MSG_TXDATA_NOT_JSON = "txData is not json"
+)
+
+// Pending reversal struct
+type PendingReversal struct {
+	PendingId  				string				`json:"pending_id"`
+	MethodName 				string				`json:"method_name"`
+	TxID 					string				`json:"tx_id"`
+	WalletId  				string				`json:"wallet_id"`
+	ReferenceId 			string				`json:"reference_id"`
+	Amount					money.Amount		`json:"amount"`
+	StatusId 				string				`json:"status_id"`
+	Data 					string				`json:"transaction_data"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+	UpdatedAt 				pgtype.Timestamp	`json:"updated_at"`
+}
+
+// pending reversals columns
+const pendingColumns = `pending_id, method_name, tx_id, wallet_id, reference_id, amount, status_id,
+	transaction_data::TEXT, created_at, updated_at`
+
+
+// Function Park parks a reversal without original transaction,
+// a reversal is parked once by method and tx-id
+func Park(methodName string, txID string, walletID string, referenceID string,
+		amount money.Amount, txData string) error {
+
+	// check parameters
+	if 	methodName == "" || txID == "" || walletID == "" || referenceID == "" || txData == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+	if !helpers.IsJSON(txData) {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
+	}
+
+	// insert pending reversal
+	_, err := db.DBWrite.Exec(context.Background(),
+		`INSERT INTO pmtol_pending_reversal(pending_id, method_name, tx_id, wallet_id, reference_id, amount,
+		status_id, transaction_data, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		ON CONFLICT (method_name, tx_id) DO NOTHING`,
+		uuid.New().String(), methodName, txID, walletID, referenceID, amount, PENDING_STATUS_PENDING, txData)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return nil
+}
+
+
+// Function GetPending gets the pending reversals of a method,
+// filtered by original transaction when referenceID is not empty
+func GetPending(methodName string, walletID string, referenceID string) ([]PendingReversal, error) {
+
+	// build query
+	qry := `SELECT ` + pendingColumns + `
+		FROM 	pmtol_pending_reversal
+		WHERE	method_name = $1 AND status_id = $2`
+	args := []interface{}{methodName, PENDING_STATUS_PENDING}
+	if referenceID != "" {
+		qry += ` AND wallet_id = $3 AND reference_id = $4`
+		args = append(args, walletID, referenceID)
+	}
+	qry += ` ORDER BY created_at`
+
+	return queryPending(qry, args...)
+}
+
+
+// Function GetByStatus gets the latest reversals with a status
+func GetByStatus(statusID string, limit int) ([]PendingReversal, error) {
+	return queryPending(`SELECT ` + pendingColumns + `
+		FROM 	pmtol_pending_reversal
+		WHERE	status_id = $1
+		ORDER BY updated_at DESC
+		LIMIT $2`, statusID, limit)
+}
+
+
+// Function SetApplied sets a pending reversal as applied
+func SetApplied(pendingID string) error {
+	return setStatus(pendingID, PENDING_STATUS_APPLIED)
+}
+
+
+// Function SetExpired sets a pending reversal as expired
+func SetExpired(pendingID string) error {
+	return setStatus(pendingID, PENDING_STATUS_EXPIRED)
+}
+
+
+// Function SetReview sets a pending reversal rejected by the
+// authorization lifecycle for manual review
+func SetReview(pendingID string) error {
+	return setStatus(pendingID, PENDING_STATUS_REVIEW)
+}
+
+
+// Sets the status of a pending reversal
+func setStatus(pendingID string, statusID string) error {
+
+	// update pending reversal
+	ctag, err := db.DBWrite.Exec(context.Background(),
+		`UPDATE pmtol_pending_reversal SET status_id = $1, updated_at = NOW()
+		WHERE pending_id = $2 AND status_id = $3`,
+		statusID, pendingID, PENDING_STATUS_PENDING)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if ctag.String() != PSQL_MSG_UPDATE_1 {
+		return fmt.Errorf(helpers.GetFunctionName() + "- pending reversal pending_id=%s is not pending", pendingID)
+	}
+
+	return nil
+}
+
+
+// Function Expire sets the reversals pending since before a
+// time as expired, returns the expired reversals
+func Expire(before time.Time) ([]PendingReversal, error) {
+	return queryPending(`UPDATE pmtol_pending_reversal SET status_id = $1, updated_at = NOW()
+		WHERE	status_id = $2 AND created_at < $3
+		RETURNING ` + pendingColumns,
+		PENDING_STATUS_EXPIRED, PENDING_STATUS_PENDING, before)
+}
+
+
+// Runs a pending reversals query and gets the values
+func queryPending(qry string, args ...interface{}) ([]PendingReversal, error) {
+
+	// get the pending reversals
+	rows, err := db.DBWrite.Query(context.Background(), qry, args...)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// get values
+	reversals := make([]PendingReversal, 0)
+	for rows.Next() {
+		var rev PendingReversal
+		err = rows.Scan(&rev.PendingId, &rev.MethodName, &rev.TxID, &rev.WalletId, &rev.ReferenceId,
+					&rev.Amount, &rev.StatusId, &rev.Data, &rev.CreatedAt, &rev.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		reversals = append(reversals, rev)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", rows.Err().Error())
+	}
+
+	return reversals, nil
+}
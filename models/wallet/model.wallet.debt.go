@@ -0,0 +1,244 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles wallet entity models
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+)
+
+// Wallet with debt struct
+type DebtWallet struct {
+	WalletId  				string				`json:"wallet_id"`
+	UserId 					string				`json:"user_id"`
+	GroupId 				string				`json:"group_id"`
+	AvalilableBalance 		money.Amount		`json:"available_balance"`
+	DebtBalance 			money.Amount		`json:"debt_balance"`
+	LastDebtAt 				pgtype.Timestamp	`json:"last_debt_at"`
+}
+
+
+// Wallet balances struct
+type Balances struct {
+	Current 				money.Amount		`json:"current_balance"`
+	Available 				money.Amount		`json:"available_balance"`
+	Blocked 				money.Amount		`json:"blocked_balance"`
+	Pending 				money.Amount		`json:"pending_balance"`
+	Debt 					money.Amount		`json:"debt_balance"`
+}
+
+
+// Credits an amount to the available balance, the wallet debt is paid first
+func (b *Balances) credit(amount money.Amount) {
+	b.Available += maxAmount(amount - b.Debt, 0)
+	b.Debt = maxAmount(b.Debt - amount, 0)
+}
+
+
+// Debits an amount from the available balance, the amount
+// without funds is recorded as debt
+func (b *Balances) debit(amount money.Amount) {
+	b.Debt += maxAmount(amount - b.Available, 0)
+	b.Available = maxAmount(b.Available - amount, 0)
+}
+
+
+// Gets the greater of two amounts
+func maxAmount(a money.Amount, b money.Amount) money.Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+
+// Withdraw amount from available_balance and transfer them to wallet
+// blocked_balance even without funds, the amount over the available_balance
+// is recorded as debt. Inserts the transaction in the transaction log.
+// Returns the debt amount.
+func WithdrawAvailableBalanceWithDebt(walletID string, amount TxAmount, txType string,
+	txDescription string, txData string) (money.Amount, error) {
+
+	return bookBalanceMovement(walletID, amount, BALANCE_WITHDRAW_AVAILABLE_DEBT, txType, txDescription, txData)
+}
+
+
+// Deposit amount to available_balance and current_balance, the wallet
+// debt is paid first. Inserts the transaction in the transaction log.
+// Returns the debt change, negative when debt was paid.
+func DepositAvailableBalanceWithDebt(walletID string, amount TxAmount, txType string,
+	txDescription string, txData string) (money.Amount, error) {
+
+	return bookBalanceMovement(walletID, amount, BALANCE_CREDIT_PENDING, txType, txDescription, txData)
+}
+
+
+// Books a balance movement of the amount without original transaction
+// and inserts the transaction in the transaction log, no pending credit
+// is released. Returns the debt change.
+func bookBalanceMovement(walletID string, amount TxAmount, movement string, txType string,
+	txDescription string, txData string) (money.Amount, error) {
+
+	// check parameters
+	if 	walletID == "" || txType == "" || txDescription == "" || txData == "" {
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+	if !helpers.IsJSON(txData) {
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
+	}
+	move, txOperation, _, err := balanceMovement(movement)
+	if err != nil {
+		return 0, err
+	}
+
+	// begin database transaction
+	ctx := context.Background()
+	tx, err := db.DBWrite.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// set transaction isolation level
+	dct, err := tx.Exec(ctx, PSQL_MSG_SET_TX_LEVEL)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if dct.String() != "SET" {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", "transaction isolation level not set")
+	}
+
+	// enable lock wallet table at row level
+	dct, err = tx.Exec(ctx, PSQL_MSG_LOCK_WALLET_TABLE)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if dct.String() != PSQL_MSG_LOCK_TABLE {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", "wallet table not locked")
+	}
+
+	// update balances on the wallet
+	txID := uuid.New().String()
+	debtAmount, err := updateBalance(ctx, tx, txID, walletID, move, amount.Amount, 0)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// insert wallet transaction
+	dct, err = tx.Exec(ctx,
+		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id,
+		transaction_operation, transaction_date, transaction_amount, transaction_description,
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		txID, walletID, txType, txOperation, amount.Amount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if dct.String() != PSQL_MSG_INSERT_1 {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- wallet_transaction transaction_id=%s not inserted", txID)
+	}
+
+	// commit database transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return debtAmount, nil
+}
+
+
+// Updates the wallet balances with a balance move in a database
+// transaction and records the debt_balance change in
+// wallet_debt_transaction. Returns the debt change, positive
+// when debt was incurred and negative when paid.
+func updateBalance(ctx context.Context, tx pgx.Tx, txID string, walletID string,
+	move balanceMove, applied money.Amount, released money.Amount) (money.Amount, error) {
+
+	// lock wallet row for update
+	var balances Balances
+	row := tx.QueryRow(ctx,
+		`SELECT current_balance, available_balance, blocked_balance, pending_balance, debt_balance
+		FROM wallet WHERE wallet_id = $1 FOR UPDATE`, walletID)
+	err := row.Scan(&balances.Current, &balances.Available, &balances.Blocked, &balances.Pending, &balances.Debt)
+	if err != nil {
+		return 0, err
+	}
+	debtBal := balances.Debt
+
+	// update balances on the wallet
+	move(&balances, applied, released)
+	uct, err := tx.Exec(ctx,
+		`UPDATE wallet SET current_balance = $1, available_balance = $2, blocked_balance = $3,
+		pending_balance = $4, debt_balance = $5
+		WHERE wallet_id = $6`,
+		balances.Current, balances.Available, balances.Blocked, balances.Pending, balances.Debt, walletID)
+	if err != nil {
+		return 0, err
+	}
+	if uct.String() != PSQL_MSG_UPDATE_1 {
+		return 0, fmt.Errorf("wallet_id=%s not updated", walletID)
+	}
+
+	// record the debt change
+	debtAmount := balances.Debt - debtBal
+	if debtAmount != 0 {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO wallet_debt_transaction(transaction_id, wallet_id, debt_amount, debt_balance, created_at)
+			VALUES ($1, $2, $3, $4, NOW())`,
+			txID, walletID, debtAmount, balances.Debt)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return debtAmount, nil
+}
+
+
+// Get the wallets with debt, largest debt first
+func GetDebtWallets(limit int) ([]DebtWallet, error) {
+
+	// get the wallets
+	rows, err := db.DBRead.Query(context.Background(),
+		`SELECT wallet.wallet_id, wallet.user_id, wallet.group_id, wallet.available_balance, wallet.debt_balance,
+		(SELECT MAX(created_at) FROM wallet_debt_transaction WHERE wallet_debt_transaction.wallet_id = wallet.wallet_id)
+		FROM 	wallet
+		WHERE	wallet.debt_balance > 0
+		ORDER BY wallet.debt_balance DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// get values
+	wallets := make([]DebtWallet, 0)
+	for rows.Next() {
+		var wallet DebtWallet
+		err = rows.Scan(&wallet.WalletId, &wallet.UserId, &wallet.GroupId, &wallet.AvalilableBalance,
+					&wallet.DebtBalance, &wallet.LastDebtAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, nil
+}
@@ -9,8 +9,10 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"github.com/kueski-dev/paymentology-paymethods/db"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
 )
 
 // wallet and user status
@@ -30,6 +32,11 @@ const(
 	PSQL_MSG_LOCK_TABLE = "LOCK TABLE"
 )
 
+// Begins a write database transaction
+var beginTx = func(ctx context.Context) (pgx.Tx, error) {
+	return db.DBWrite.Begin(ctx)
+}
+
 // Wallet transaction operations
 const (
 	TX_OPER_WITHDRAW 	= "W"
@@ -39,16 +46,18 @@ const (
 
 // CardInfo struct
 type WalletInfo struct {
-	WalletId  				string		`json:"wallet_id"`
-	StatusId 				string		`json:"status_id"`
-	CurrencyCode 			string		`json:"currency_numeric_code"`
-	CurrentBalance 			float64		`json:"current_balance"`
-	AvalilableBalance 		float64		`json:"available_balance"`
-	BlockedBalance 			float64		`json:"blocked_balance"`
-	UserId 					string		`json:"user_id"`
-	UserStatusId 			string		`json:"user_status_id"`
-	GroupId 				string		`json:"group_id"`
-	GroupStatusId			string		`json:"group_status_id"`
+	WalletId  				string			`json:"wallet_id"`
+	StatusId 				string			`json:"status_id"`
+	CurrencyCode 			string			`json:"currency_numeric_code"`
+	CurrentBalance 			money.Amount	`json:"current_balance"`
+	AvalilableBalance 		money.Amount	`json:"available_balance"`
+	BlockedBalance 			money.Amount	`json:"blocked_balance"`
+	PendingBalance 			money.Amount	`json:"pending_balance"`
+	DebtBalance 			money.Amount	`json:"debt_balance"`
+	UserId 					string			`json:"user_id"`
+	UserStatusId 			string			`json:"user_status_id"`
+	GroupId 				string			`json:"group_id"`
+	GroupStatusId			string			`json:"group_status_id"`
 }
 
 // Wallet transaction struct
@@ -59,9 +68,21 @@ type WalletTransaction struct {
 	TypeId 					string				`json:"transaction_type_id"`
 	Operation 				string				`json:"transaction_operation"`
 	Date 					pgtype.Timestamp	`json:"transaction_date"`	
-	Amount					float64				`json:"transaction_amount"`
+	Amount					money.Amount		`json:"transaction_amount"`
 	Description 			string				`json:"transaction_description"`
 	Data 					pgtype.JSON			`json:"transaction_data"`
+	OriginalAmount			money.Amount		`json:"original_amount"`
+	OriginalCurrency		string				`json:"original_currency_code"`
+}
+
+// Transaction amount struct, the amount in the wallet currency
+// and the original amount in the transaction currency, an amount
+// booked without a valid conversion is flagged for review
+type TxAmount struct {
+	Amount 					money.Amount
+	OriginalAmount 			money.Amount
+	OriginalCurrency 		string
+	Review 					bool
 }
 
 const MSG_EMPTY_PARAMETERS = "paramaters cannot be empty"
@@ -77,6 +98,12 @@ func IsActive(wallet *WalletInfo) bool {
 }
 
 
+// Function NewTxAmount builds a transaction amount in the wallet currency
+func NewTxAmount(amount money.Amount) TxAmount {
+	return TxAmount{Amount: amount, OriginalAmount: amount}
+}
+
+
 // Get a wallet info
 func GetInfo(walletID string) (*WalletInfo, error) {
 
@@ -89,14 +116,14 @@ func GetInfo(walletID string) (*WalletInfo, error) {
 	// get the card
 	row := db.DBRead.QueryRow(context.Background(),
 		`SELECT wallet.wallet_id, wallet.status_id, wallet.currency_numeric_code, wallet.current_balance, wallet.available_balance, 
-		wallet.blocked_balance, wallet.user_id, usr.status_id, wallet.group_id, wallet_group.status_id
+		wallet.blocked_balance, wallet.pending_balance, wallet.debt_balance, wallet.user_id, usr.status_id, wallet.group_id, wallet_group.status_id
 		FROM 	wallet, "user" usr, wallet_group
 		WHERE	wallet.wallet_id = $1 AND wallet.user_id = usr.user_id AND wallet.group_id = wallet_group.group_id`, 
 		walletID)
 
 	// get values
 	err := row.Scan(&wallet.WalletId, &wallet.StatusId, &wallet.CurrencyCode, &wallet.CurrentBalance, 
-				&wallet.AvalilableBalance, &wallet.BlockedBalance, &wallet.UserId, &wallet.UserStatusId,
+				&wallet.AvalilableBalance, &wallet.BlockedBalance, &wallet.PendingBalance, &wallet.DebtBalance, &wallet.UserId, &wallet.UserStatusId,
 				&wallet.GroupId, &wallet.GroupStatusId)
 	if err != nil {
 		return nil, fmt.Errorf(helpers.GetFunctionName() + "- wallet_id=%s does not exists", walletID)
@@ -111,6 +138,26 @@ func GetInfo(walletID string) (*WalletInfo, error) {
 }
 
 
+// Get a wallet currency ISO 4217 numeric code
+func GetCurrency(walletID string) (string, error) {
+	var currencyCode string
+
+	if 	walletID == "" {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// get the currency
+	row := db.DBRead.QueryRow(context.Background(),
+		"SELECT currency_numeric_code FROM wallet WHERE wallet_id = $1", walletID)
+	err := row.Scan(&currencyCode)
+	if err != nil {
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- wallet_id=%s does not exists", walletID)
+	}
+
+	return currencyCode, nil
+}
+
+
 // Get a transaction info
 func GetTransaction(walletID string, txId string, externalId bool) (*WalletTransaction, error) {
 
@@ -121,13 +168,15 @@ func GetTransaction(walletID string, txId string, externalId bool) (*WalletTrans
 	if externalId {
 		// get using external transaction id
 		qry = `SELECT transaction_id, wallet_id, group_id, transaction_type_id, transaction_operation, transaction_date, 
-		transaction_amount, transaction_description, transaction_data
+		transaction_amount, transaction_description, transaction_data,
+		COALESCE(original_amount, transaction_amount), COALESCE(original_currency_code, '')
 		FROM 	wallet_transaction
 		WHERE	wallet_transaction.wallet_id = $1 AND wallet_transaction.transaction_data ->> 'tx-id' = $2`
 	} else {
 		// get using internal transaction id
 		qry = `SELECT transaction_id, wallet_id, group_id, transaction_type_id, transaction_operation, transaction_date, 
-		transaction_amount, transaction_description, transaction_data
+		transaction_amount, transaction_description, transaction_data,
+		COALESCE(original_amount, transaction_amount), COALESCE(original_currency_code, '')
 		FROM 	wallet_transaction
 		WHERE	wallet_transaction.wallet_id = $1 AND wallet_transaction.transaction_id = $2`
 	}
@@ -147,7 +196,8 @@ func GetTransaction(walletID string, txId string, externalId bool) (*WalletTrans
 
 	// get values
 	rows.Scan(&walletTX.TransactionId, &walletTX.WalletId, &walletTX.GroupId, &walletTX.TypeId, &walletTX.Operation,
-				&walletTX.Date, &walletTX.Amount, &walletTX.Description, &walletTX.Data)
+				&walletTX.Date, &walletTX.Amount, &walletTX.Description, &walletTX.Data,
+				&walletTX.OriginalAmount, &walletTX.OriginalCurrency)
 	
  	
 
@@ -160,8 +210,45 @@ func GetTransaction(walletID string, txId string, externalId bool) (*WalletTrans
 }
 
 
+// Get the booked original transaction of a reversal or adjustment by
+// the external transaction id, the transaction type and operation.
+// Declined transactions are only logged and are never an original,
+// returns nil when no booked transaction is found
+func GetOriginalTransaction(walletID string, txId string, txType string, txOperation string) (*WalletTransaction, error) {
+
+	// check parameters
+	if 	walletID == "" || txId == "" || txType == "" || txOperation == "" {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// get the transaction
+	walletTX := new(WalletTransaction)
+	row := db.DBRead.QueryRow(context.Background(),
+		`SELECT transaction_id, wallet_id, group_id, transaction_type_id, transaction_operation, transaction_date,
+		transaction_amount, transaction_description, transaction_data,
+		COALESCE(original_amount, transaction_amount), COALESCE(original_currency_code, '')
+		FROM 	wallet_transaction
+		WHERE	wallet_transaction.wallet_id = $1 AND wallet_transaction.transaction_data ->> 'tx-id' = $2
+		AND 	wallet_transaction.transaction_type_id = $3 AND wallet_transaction.transaction_operation = $4
+		ORDER BY wallet_transaction.transaction_date
+		LIMIT 1`,
+		walletID, txId, txType, txOperation)
+	err := row.Scan(&walletTX.TransactionId, &walletTX.WalletId, &walletTX.GroupId, &walletTX.TypeId, &walletTX.Operation,
+				&walletTX.Date, &walletTX.Amount, &walletTX.Description, &walletTX.Data,
+				&walletTX.OriginalAmount, &walletTX.OriginalCurrency)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return walletTX, nil
+}
+
+
 // Insert a transaction in the wallet transaction log.
-func PostTransaction(walletID string, amount float64, txType string, txOperation string, 
+func PostTransaction(walletID string, amount TxAmount, txType string, txOperation string, 
 					txDescription string, txData string) (string, error) {
 
 	// check parameters
@@ -184,9 +271,10 @@ func PostTransaction(walletID string, amount float64, txType string, txOperation
 	ctag, err := tx.Exec(ctx,
 		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id, 
 		transaction_operation, transaction_date, transaction_amount, transaction_description, 
-		transaction_data, created_at)
-		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, NOW())`,
-		txID, walletID, txType, txOperation, amount, txDescription, txData)
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		txID, walletID, txType, txOperation, amount.Amount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
 	if err != nil || ctag.String() != PSQL_MSG_INSERT_1 {
 		tx.Rollback(ctx)
 		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
@@ -204,60 +292,78 @@ func PostTransaction(walletID string, amount float64, txType string, txOperation
 
 // Withdraw amount from available_balance and transfer them to wallet 
 // blocked_balance and insert the transaction in the transaction log.
-func WithdrawAvailableBalance(walletID string, amount float64, matchBalance float64, 
-	txType string, txDescription string, txData string) (error) {
+// The spending limits are checked with the usage read while the wallet
+// row is locked, returns the limit exceeded without withdrawing.
+func WithdrawAvailableBalance(walletID string, amount TxAmount, matchBalance money.Amount, limitCheck *LimitCheck,
+	txType string, txDescription string, txData string) (string, error) {
 
 	// check parameters
 	if 	walletID == "" || txType == "" || txDescription == "" || txData == "" {
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
 	}
 	if !helpers.IsJSON(txData) {
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
 	}
 
 	// begin database transaction
 	ctx := context.Background()
-	tx, err := db.DBWrite.Begin(ctx)
+	tx, err := beginTx(ctx)
 	if err != nil {
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
 	// set transaction isolation level
 	cmdt, err := tx.Exec(ctx, PSQL_MSG_SET_TX_LEVEL)
 	if err != nil || cmdt.String() != "SET" {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
 	// enable lock wallet table at row level
 	cmdt, err = tx.Exec(ctx, PSQL_MSG_LOCK_WALLET_TABLE)
 	if err != nil || cmdt.String() != PSQL_MSG_LOCK_TABLE {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
 	// lock wallet row for update
-	var availableBal float64
+	var availableBal money.Amount
 	row := tx.QueryRow(ctx, "SELECT available_balance FROM wallet WHERE wallet_id = $1 FOR UPDATE", walletID)
 	err = row.Scan(&availableBal)
 	if err != nil {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
 	// check available balance match
 	if availableBal != matchBalance {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", "available balance does not match")
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", "available balance does not match")
+	}
+
+	// check spending limits with the usage of the locked wallet
+	if limitCheck != nil {
+		limits, err := getLimits(ctx, tx, walletID, limitCheck.CardId, limitCheck.TxTypes)
+		if err != nil {
+			tx.Rollback(ctx)
+			return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		if limits != nil {
+			exceeded := limits.Exceeds(amount.Amount, limitCheck.ATM)
+			if exceeded != "" {
+				tx.Rollback(ctx)
+				return exceeded, nil
+			}
+		}
 	}
 
 	// update balances on the wallet
 	cmdt, err = tx.Exec(ctx, 
 		"UPDATE wallet SET available_balance = available_balance - $1, blocked_balance = blocked_balance + $1 WHERE wallet_id = $2 AND available_balance = $3",
-		amount, walletID, matchBalance)
+		amount.Amount, walletID, matchBalance)
 	if err != nil || cmdt.String() != PSQL_MSG_UPDATE_1 {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
 	// insert wallet transaction
@@ -265,28 +371,29 @@ func WithdrawAvailableBalance(walletID string, amount float64, matchBalance floa
 	cmdt, err = tx.Exec(ctx,
 		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id, 
 		transaction_operation, transaction_date, transaction_amount, transaction_description, 
-		transaction_data, created_at)
-		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, NOW())`,
-		txID, walletID, txType, TX_OPER_WITHDRAW, amount, txDescription, txData)
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		txID, walletID, txType, TX_OPER_WITHDRAW, amount.Amount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
 	if err != nil || cmdt.String() != PSQL_MSG_INSERT_1 {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
 	// commit database transaction
 	err = tx.Commit(ctx)
 	if err != nil {
 		tx.Rollback(ctx)
-		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		return "", fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
 	}
 
-	return nil
+	return "", nil
 }
 
 
 // Withdraw amount from blocked_balance and insert the transaction
 // in the transaction log.
-func WithdrawBlockedBalance(walletID string, amount float64, txType string, 
+func WithdrawBlockedBalance(walletID string, amount TxAmount, txType string, 
 	txDescription string, txData string) (error) {
 
 	// check parameters
@@ -319,7 +426,7 @@ func WithdrawBlockedBalance(walletID string, amount float64, txType string,
 	}
 
 	// lock wallet row for update
-	var blockedBal float64
+	var blockedBal money.Amount
 	row := tx.QueryRow(ctx, "SELECT blocked_balance FROM wallet WHERE wallet_id = $1 FOR UPDATE", walletID)
 	err = row.Scan(&blockedBal)
 	if err != nil {
@@ -330,7 +437,7 @@ func WithdrawBlockedBalance(walletID string, amount float64, txType string,
 	// update balances on the wallet
 	wct, err = tx.Exec(ctx, 
 		"UPDATE wallet SET blocked_balance = blocked_balance - $1 WHERE wallet_id = $2 AND blocked_balance = $3",
-		amount, walletID, blockedBal)
+		amount.Amount, walletID, blockedBal)
 	if err != nil || wct.String() != PSQL_MSG_UPDATE_1 {
 		tx.Rollback(ctx)
 		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
@@ -341,9 +448,10 @@ func WithdrawBlockedBalance(walletID string, amount float64, txType string,
 	wct, err = tx.Exec(ctx,
 		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id, 
 		transaction_operation, transaction_date, transaction_amount, transaction_description, 
-		transaction_data, created_at)
-		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, NOW())`,
-		txID, walletID, txType, TX_OPER_INFO, amount, txDescription, txData)
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		txID, walletID, txType, TX_OPER_INFO, amount.Amount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
 	if err != nil || wct.String() != PSQL_MSG_INSERT_1 {
 		tx.Rollback(ctx)
 		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
@@ -362,7 +470,7 @@ func WithdrawBlockedBalance(walletID string, amount float64, txType string,
 
 // Deposit amount from blocked_balance and insert the transaction
 // in the transaction log.
-func DepositBlockedBalance(walletID string, amount float64, txType string, 
+func DepositBlockedBalance(walletID string, amount TxAmount, txType string, 
 	txDescription string, txData string) (error) {
 
 	// check parameters
@@ -395,7 +503,7 @@ func DepositBlockedBalance(walletID string, amount float64, txType string,
 	}
 
 	// lock wallet row for update
-	var blockedBal float64
+	var blockedBal money.Amount
 	row := tx.QueryRow(ctx, "SELECT blocked_balance FROM wallet WHERE wallet_id = $1 FOR UPDATE", walletID)
 	err = row.Scan(&blockedBal)
 	if err != nil {
@@ -406,7 +514,7 @@ func DepositBlockedBalance(walletID string, amount float64, txType string,
 	// update balances on the wallet
 	dct, err = tx.Exec(ctx, 
 		"UPDATE wallet SET blocked_balance = blocked_balance + $1 WHERE wallet_id = $2 AND blocked_balance = $3",
-		amount, walletID, blockedBal)
+		amount.Amount, walletID, blockedBal)
 	if err != nil || dct.String() != PSQL_MSG_UPDATE_1 {
 		tx.Rollback(ctx)
 		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
@@ -417,9 +525,10 @@ func DepositBlockedBalance(walletID string, amount float64, txType string,
 	dct, err = tx.Exec(ctx,
 		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id, 
 		transaction_operation, transaction_date, transaction_amount, transaction_description, 
-		transaction_data, created_at)
-		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, NOW())`,
-		txID, walletID, txType, TX_OPER_INFO, amount, txDescription, txData)
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		txID, walletID, txType, TX_OPER_INFO, amount.Amount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
 	if err != nil || dct.String() != PSQL_MSG_INSERT_1 {
 		tx.Rollback(ctx)
 		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
@@ -435,3 +544,87 @@ func DepositBlockedBalance(walletID string, amount float64, txType string,
 	return nil
 }
 
+
+// Deposit amount to pending_balance and insert the transaction
+// in the transaction log, the pending credit is moved to the
+// available_balance or released later.
+func DepositPendingBalance(walletID string, amount TxAmount, txType string, 
+	txDescription string, txData string) (error) {
+
+	// check parameters
+	if 	walletID == "" || txType == "" || txDescription == "" || txData == "" {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+	if !helpers.IsJSON(txData) {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
+	}
+
+	// begin database transaction
+	ctx := context.Background()
+	tx, err := beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// set transaction isolation level
+	pct, err := tx.Exec(ctx, PSQL_MSG_SET_TX_LEVEL)
+	if err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if pct.String() != "SET" {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", "transaction isolation level not set")
+	}
+
+	// enable lock wallet table at row level
+	pct, err = tx.Exec(ctx, PSQL_MSG_LOCK_WALLET_TABLE)
+	if err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if pct.String() != PSQL_MSG_LOCK_TABLE {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", "wallet table not locked")
+	}
+
+	// update balances on the wallet
+	pct, err = tx.Exec(ctx, 
+		"UPDATE wallet SET pending_balance = pending_balance + $1 WHERE wallet_id = $2",
+		amount.Amount, walletID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if pct.String() != PSQL_MSG_UPDATE_1 {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- wallet_id=%s not updated", walletID)
+	}
+
+	// insert wallet transaction
+	txID := uuid.New().String()
+	pct, err = tx.Exec(ctx,
+		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id, 
+		transaction_operation, transaction_date, transaction_amount, transaction_description, 
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		txID, walletID, txType, TX_OPER_INFO, amount.Amount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
+	if err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if pct.String() != PSQL_MSG_INSERT_1 {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- wallet_transaction transaction_id=%s not inserted", txID)
+	}
+
+	// commit database transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return nil
+}
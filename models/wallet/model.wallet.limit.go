@@ -0,0 +1,165 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles wallet entity models
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+)
+
+// Spending limits
+const (
+	LIMIT_TRANSACTION 			= "transaction"
+	LIMIT_DAILY 				= "daily"
+	LIMIT_MONTHLY 				= "monthly"
+	LIMIT_ATM_DAILY_COUNT 		= "atm daily count"
+	LIMIT_ATM_DAILY 			= "atm daily"
+	LIMIT_CARD_ATM_DAILY_COUNT 	= "card atm daily count"
+	LIMIT_CARD_ATM_DAILY 		= "card atm daily"
+)
+
+// Spending limits check of a withdrawal, the card usage is
+// counted for the card id of ATM cash withdrawals
+type LimitCheck struct {
+	CardId 					string
+	ATM 					bool
+	TxTypes 				[]string
+}
+
+// Database rows reader, a connection pool or a transaction
+type rowReader interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Wallet spending limits and usage struct, a zero limit is not enforced
+type WalletLimits struct {
+	WalletId  				string			`json:"wallet_id"`
+	GroupId 				string			`json:"group_id"`
+	TransactionLimit 		money.Amount	`json:"transaction_limit"`
+	DailyLimit 				money.Amount	`json:"daily_limit"`
+	MonthlyLimit 			money.Amount	`json:"monthly_limit"`
+	DailyUsed 				money.Amount	`json:"daily_used"`
+	MonthlyUsed 			money.Amount	`json:"monthly_used"`
+	ATMDailyCount 			int64			`json:"atm_daily_count"`
+	ATMDailyLimit 			money.Amount	`json:"atm_daily_limit"`
+	ATMDailyCountUsed 		int64			`json:"atm_daily_count_used"`
+	ATMDailyUsed 			money.Amount	`json:"atm_daily_used"`
+	CardATMDailyCount 		int64			`json:"card_atm_daily_count"`
+	CardATMDailyLimit 		money.Amount	`json:"card_atm_daily_limit"`
+	CardATMDailyCountUsed 	int64			`json:"card_atm_daily_count_used"`
+	CardATMDailyUsed 		money.Amount	`json:"card_atm_daily_used"`
+}
+
+
+// Function Exceeds checks an amount against the limits, ATM cash
+// withdrawals are also checked against the wallet and card ATM limits.
+// Returns the limit exceeded or an empty string when it is allowed
+func (l *WalletLimits) Exceeds(amount money.Amount, atm bool) string {
+	if l.TransactionLimit > 0 && amount > l.TransactionLimit {
+		return LIMIT_TRANSACTION
+	}
+	if l.DailyLimit > 0 && l.DailyUsed + amount > l.DailyLimit {
+		return LIMIT_DAILY
+	}
+	if l.MonthlyLimit > 0 && l.MonthlyUsed + amount > l.MonthlyLimit {
+		return LIMIT_MONTHLY
+	}
+	if !atm {
+		return ""
+	}
+	if l.ATMDailyCount > 0 && l.ATMDailyCountUsed + 1 > l.ATMDailyCount {
+		return LIMIT_ATM_DAILY_COUNT
+	}
+	if l.ATMDailyLimit > 0 && l.ATMDailyUsed + amount > l.ATMDailyLimit {
+		return LIMIT_ATM_DAILY
+	}
+	if l.CardATMDailyCount > 0 && l.CardATMDailyCountUsed + 1 > l.CardATMDailyCount {
+		return LIMIT_CARD_ATM_DAILY_COUNT
+	}
+	if l.CardATMDailyLimit > 0 && l.CardATMDailyUsed + amount > l.CardATMDailyLimit {
+		return LIMIT_CARD_ATM_DAILY
+	}
+	return ""
+}
+
+
+// Get the wallet spending limits and the day and month usage. The
+// wallet_limit values override the wallet_group defaults, the usage
+// is the withdrawn amount of the transaction types not yet reversed.
+// The ATM usage counts the ATM cash withdrawals of the day not fully
+// reversed, the card usage is for the card id of the transaction
+// data. Days and months follow the database time zone. Returns nil
+// when the wallet is not found. The limits are enforced with the
+// usage read in the withdrawal transaction, see WithdrawAvailableBalance.
+func GetLimits(walletID string, cardID string, txTypes []string) (*WalletLimits, error) {
+	return getLimits(context.Background(), db.DBRead, walletID, cardID, txTypes)
+}
+
+
+// Gets the wallet spending limits and usage with a rows reader
+func getLimits(ctx context.Context, db rowReader, walletID string, cardID string, txTypes []string) (*WalletLimits, error) {
+
+	// check parameters
+	if 	walletID == "" || len(txTypes) == 0 {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+
+	// get the limits
+	limits := new(WalletLimits)
+	row := db.QueryRow(ctx,
+		`SELECT wallet.wallet_id, wallet.group_id,
+		COALESCE(wallet_limit.transaction_limit, wallet_group.transaction_limit, 0),
+		COALESCE(wallet_limit.daily_limit, wallet_group.daily_limit, 0),
+		COALESCE(wallet_limit.monthly_limit, wallet_group.monthly_limit, 0),
+		COALESCE(wallet_limit.atm_daily_count, wallet_group.atm_daily_count, 0),
+		COALESCE(wallet_limit.atm_daily_limit, wallet_group.atm_daily_limit, 0),
+		COALESCE(wallet_limit.card_atm_daily_count, wallet_group.card_atm_daily_count, 0),
+		COALESCE(wallet_limit.card_atm_daily_limit, wallet_group.card_atm_daily_limit, 0)
+		FROM 	wallet
+		JOIN 	wallet_group ON wallet_group.group_id = wallet.group_id
+		LEFT JOIN wallet_limit ON wallet_limit.wallet_id = wallet.wallet_id
+		WHERE	wallet.wallet_id = $1`, walletID)
+	err := row.Scan(&limits.WalletId, &limits.GroupId, &limits.TransactionLimit, &limits.DailyLimit, &limits.MonthlyLimit,
+				&limits.ATMDailyCount, &limits.ATMDailyLimit, &limits.CardATMDailyCount, &limits.CardATMDailyLimit)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// get the running totals of the day and the month
+	row = db.QueryRow(ctx,
+		`SELECT
+		COALESCE(SUM(net_amount) FILTER (WHERE today), 0),
+		COALESCE(SUM(net_amount), 0),
+		COUNT(*) FILTER (WHERE today AND atm AND net_amount > 0),
+		COALESCE(SUM(net_amount) FILTER (WHERE today AND atm), 0),
+		COUNT(*) FILTER (WHERE today AND atm AND net_amount > 0 AND card_id = $4),
+		COALESCE(SUM(net_amount) FILTER (WHERE today AND atm AND card_id = $4), 0)
+		FROM (
+			SELECT 	wallet_transaction.transaction_amount - COALESCE(wallet_transaction_original.reversed_amount, 0) AS net_amount,
+					wallet_transaction.transaction_date >= date_trunc('day', LOCALTIMESTAMP) AS today,
+					COALESCE((wallet_transaction.transaction_data ->> 'atm')::boolean, FALSE) AS atm,
+					wallet_transaction.transaction_data ->> 'card-id' AS card_id
+			FROM 	wallet_transaction
+			LEFT JOIN wallet_transaction_original ON wallet_transaction_original.transaction_id = wallet_transaction.transaction_id
+			WHERE	wallet_transaction.wallet_id = $1 AND wallet_transaction.transaction_type_id = ANY($2)
+			AND 	wallet_transaction.transaction_operation = $3
+			AND 	wallet_transaction.transaction_date >= date_trunc('month', LOCALTIMESTAMP)
+		) usage`,
+		walletID, txTypes, TX_OPER_WITHDRAW, cardID)
+	err = row.Scan(&limits.DailyUsed, &limits.MonthlyUsed, &limits.ATMDailyCountUsed, &limits.ATMDailyUsed,
+				&limits.CardATMDailyCountUsed, &limits.CardATMDailyUsed)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return limits, nil
+}
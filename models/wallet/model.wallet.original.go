@@ -0,0 +1,417 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles wallet entity models
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/kueski-dev/paymentology-paymethods/db"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+)
+
+// Original transaction states, the state decides if a reversal
+// or adjustment changes the balances or is only logged
+const (
+	ORIGINAL_STATE_AUTHORIZED 			= "AUTHO"
+	ORIGINAL_STATE_PARTIALLY_REVERSED 	= "PAREV"
+	ORIGINAL_STATE_REVERSED 			= "REVER"
+	ORIGINAL_STATE_ADJUSTED 			= "ADJUS"
+)
+
+// Balance movements of the reversals and adjustments
+const (
+	BALANCE_WITHDRAW_AVAILABLE 	= "WA"		// from available_balance to blocked_balance
+	BALANCE_WITHDRAW_BLOCKED 	= "WB"		// from blocked_balance
+	BALANCE_DEPOSIT_BLOCKED 	= "DB"		// to blocked_balance
+	BALANCE_RELEASE_PENDING 	= "RP"		// from pending_balance
+	BALANCE_CREDIT_PENDING 		= "CP"		// pending credit released and amount credited to available_balance
+	BALANCE_DEBIT_AVAILABLE 	= "DA"		// from available_balance, the amount without funds is debt
+	BALANCE_WITHDRAW_AVAILABLE_DEBT = "WD"	// from available_balance to blocked_balance, the amount without funds is debt
+)
+
+// Balance move, changes the wallet balances with the applied
+// amount and the pending credit released
+type balanceMove func(b *Balances, applied money.Amount, released money.Amount)
+
+// Check of a reversal or adjustment made in the database transaction
+// of the balance update, it rejects the link or flags it for review
+type LinkCheck func(ctx context.Context, tx pgx.Tx, result *LinkResult) error
+
+// Reversal or adjustment result struct
+type LinkResult struct {
+	RequestedAmount 		money.Amount	`json:"requested_amount"`
+	AppliedAmount 			money.Amount	`json:"applied_amount"`
+	ReleasedAmount 			money.Amount	`json:"released_amount"`
+	DebtAmount 				money.Amount	`json:"debt_amount"`
+	ReversedAmount 			money.Amount	`json:"reversed_amount"`
+	OriginalAmount 			money.Amount	`json:"original_amount"`
+	PreviousState 			string			`json:"previous_state"`
+	State 					string			`json:"state"`
+	Duplicated 				bool			`json:"duplicated"`
+	Rejected 				bool			`json:"rejected"`
+	Review 					bool			`json:"review"`
+}
+
+// Original transaction struct
+type OriginalTransaction struct {
+	TransactionId  			string				`json:"transaction_id"`
+	WalletId  				string				`json:"wallet_id"`
+	OriginalAmount			money.Amount		`json:"original_amount"`
+	ReversedAmount			money.Amount		`json:"reversed_amount"`
+	StateId 				string				`json:"state_id"`
+	Review 					bool				`json:"review"`
+	CreatedAt 				pgtype.Timestamp	`json:"created_at"`
+	UpdatedAt 				pgtype.Timestamp	`json:"updated_at"`
+}
+
+
+// Function IsFull checks if the original transaction is fully reversed
+func (r *LinkResult) IsFull() bool {
+	return r.ReversedAmount >= r.OriginalAmount
+}
+
+
+// Reverse an amount of an original transaction, the reversal is linked
+// to the original in wallet_transaction_link and the cumulative reversed
+// amount and state of the original are kept in wallet_transaction_original.
+// Only the amount not yet reversed is applied to the balance, a reversal
+// over it is flagged for manual review. A reversal tx-id already linked
+// is a duplicated message and a rejected reversal is only recorded by
+// the check, both do not change the balances.
+func ReverseTransaction(original *WalletTransaction, txID string, amount TxAmount, movement string, check LinkCheck,
+	txType string, txDescription string, txData string) (*LinkResult, error) {
+
+	return linkTransaction(original, txID, amount, movement, txType, txDescription, txData,
+		check, reverseOriginal(amount))
+}
+
+
+// Adjust an original transaction, the adjustment is linked to the
+// original in wallet_transaction_link. An original already adjusted
+// or reversed is not adjusted again, the adjustment is only logged,
+// except debits with debt that are always booked and flagged for review.
+// The pending credit released is the original amount not yet reversed.
+// An adjustment tx-id already linked is a duplicated message and a
+// rejected adjustment is only recorded by the check, both do not
+// change the balances.
+func AdjustTransaction(original *WalletTransaction, txID string, amount TxAmount, movement string, check LinkCheck,
+	txType string, txDescription string, txData string) (*LinkResult, error) {
+
+	return linkTransaction(original, txID, amount, movement, txType, txDescription, txData,
+		check, adjustOriginal(amount, movement))
+}
+
+
+// Gets the apply function of a reversal, the amount not yet
+// reversed is applied and the reversed amount and state updated
+func reverseOriginal(amount TxAmount) func(*OriginalTransaction, *LinkResult) {
+	return func(orig *OriginalTransaction, result *LinkResult) {
+		// apply the amount not yet reversed
+		remaining := orig.OriginalAmount - orig.ReversedAmount
+		if remaining < 0 {
+			remaining = 0
+		}
+		result.AppliedAmount = amount.Amount
+		if amount.Amount > remaining {
+			result.AppliedAmount = remaining
+			result.Review = true
+		}
+
+		// update the reversed amount and state
+		orig.ReversedAmount += result.AppliedAmount
+		if orig.ReversedAmount >= orig.OriginalAmount {
+			orig.StateId = ORIGINAL_STATE_REVERSED
+		} else if orig.ReversedAmount > 0 {
+			orig.StateId = ORIGINAL_STATE_PARTIALLY_REVERSED
+		}
+	}
+}
+
+
+// Gets the apply function of an adjustment, a partially reversed
+// original is adjusted and releases the amount not yet reversed
+func adjustOriginal(amount TxAmount, movement string) func(*OriginalTransaction, *LinkResult) {
+	return func(orig *OriginalTransaction, result *LinkResult) {
+		if orig.StateId == ORIGINAL_STATE_ADJUSTED || orig.StateId == ORIGINAL_STATE_REVERSED {
+			result.AppliedAmount = 0
+			if movement == BALANCE_WITHDRAW_AVAILABLE_DEBT {
+				result.AppliedAmount, result.Review = amount.Amount, true
+			}
+			return
+		}
+		result.AppliedAmount = amount.Amount
+		result.ReleasedAmount = orig.OriginalAmount - orig.ReversedAmount
+		if result.ReleasedAmount < 0 {
+			result.ReleasedAmount = 0
+		}
+		orig.StateId = ORIGINAL_STATE_ADJUSTED
+	}
+}
+
+
+// Links a transaction to its original transaction in a database
+// transaction, the check is made in the same database transaction
+// before the link. The apply function sets the amount applied to
+// the balances and updates the original transaction values
+func linkTransaction(original *WalletTransaction, txID string, amount TxAmount, movement string,
+	txType string, txDescription string, txData string, check LinkCheck,
+	apply func(*OriginalTransaction, *LinkResult)) (*LinkResult, error) {
+
+	// check parameters
+	if 	original == nil || txID == "" || txType == "" || txDescription == "" || txData == "" {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_EMPTY_PARAMETERS)
+	}
+	if !helpers.IsJSON(txData) {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", MSG_TXDATA_NOT_JSON)
+	}
+	move, txOperation, releases, err := balanceMovement(movement)
+	if err != nil {
+		return nil, err
+	}
+
+	// begin database transaction
+	ctx := context.Background()
+	tx, err := beginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	// set transaction isolation level
+	lct, err := tx.Exec(ctx, PSQL_MSG_SET_TX_LEVEL)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if lct.String() != "SET" {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", "transaction isolation level not set")
+	}
+
+	// enable lock wallet table at row level
+	lct, err = tx.Exec(ctx, PSQL_MSG_LOCK_WALLET_TABLE)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if lct.String() != PSQL_MSG_LOCK_TABLE {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", "wallet table not locked")
+	}
+
+	// lock original transaction for update
+	orig, err := lockOriginal(ctx, tx, original)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	result := &LinkResult{RequestedAmount: amount.Amount, OriginalAmount: orig.OriginalAmount, PreviousState: orig.StateId}
+
+	// check the link, a rejected link is committed with the check
+	// records and does not change the balances
+	if check != nil {
+		err = check(ctx, tx, result)
+		if err != nil {
+			tx.Rollback(ctx)
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		if result.Rejected {
+			err = tx.Commit(ctx)
+			if err != nil {
+				tx.Rollback(ctx)
+				return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+			}
+			result.ReversedAmount, result.State = orig.ReversedAmount, orig.StateId
+			return result, nil
+		}
+	}
+
+	// link the transaction, the tx-id is unique by transaction type
+	linkTxID := uuid.New().String()
+	lct, err = tx.Exec(ctx,
+		`INSERT INTO wallet_transaction_link(transaction_id, original_transaction_id, transaction_type_id, tx_id, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (transaction_type_id, tx_id) DO NOTHING`,
+		linkTxID, orig.TransactionId, txType, txID)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if lct.String() != PSQL_MSG_INSERT_1 {
+		// duplicated message
+		tx.Rollback(ctx)
+		result.Duplicated, result.ReversedAmount, result.State = true, orig.ReversedAmount, orig.StateId
+		return result, nil
+	}
+
+	// get the applied amount and the original new values
+	apply(orig, result)
+	result.ReversedAmount, result.State = orig.ReversedAmount, orig.StateId
+	orig.Review = orig.Review || result.Review || amount.Review
+
+	// update balances on the wallet
+	if !releases {
+		result.ReleasedAmount = 0
+	}
+	if result.AppliedAmount > 0 || result.ReleasedAmount > 0 {
+		result.DebtAmount, err = updateBalance(ctx, tx, linkTxID, orig.WalletId, move, result.AppliedAmount, result.ReleasedAmount)
+		if err != nil {
+			tx.Rollback(ctx)
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+	} else {
+		// only logged
+		txOperation = TX_OPER_INFO
+	}
+
+	// insert wallet transaction
+	lct, err = tx.Exec(ctx,
+		`INSERT INTO wallet_transaction(transaction_id, wallet_id, group_id, transaction_type_id,
+		transaction_operation, transaction_date, transaction_amount, transaction_description,
+		transaction_data, original_amount, original_currency_code, created_at)
+		VALUES ($1, $2,'PMTOL', $3, $4, NOW(), $5, $6, $7, $8, NULLIF($9, ''), NOW())`,
+		linkTxID, orig.WalletId, txType, txOperation, result.AppliedAmount, txDescription, txData,
+		amount.OriginalAmount, amount.OriginalCurrency)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if lct.String() != PSQL_MSG_INSERT_1 {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- wallet_transaction transaction_id=%s not inserted", linkTxID)
+	}
+
+	// update original transaction
+	lct, err = tx.Exec(ctx,
+		`UPDATE wallet_transaction_original SET reversed_amount = $1, state_id = $2, review = $3, updated_at = NOW()
+		WHERE transaction_id = $4`,
+		orig.ReversedAmount, orig.StateId, orig.Review, orig.TransactionId)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	if lct.String() != PSQL_MSG_UPDATE_1 {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- wallet_transaction_original transaction_id=%s not updated", orig.TransactionId)
+	}
+
+	// commit database transaction
+	err = tx.Commit(ctx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+
+	return result, nil
+}
+
+
+// Locks the original transaction values for update, the values
+// are created in the authorized state the first time
+func lockOriginal(ctx context.Context, tx pgx.Tx, original *WalletTransaction) (*OriginalTransaction, error) {
+
+	// create the original transaction values
+	_, err := tx.Exec(ctx,
+		`INSERT INTO wallet_transaction_original(transaction_id, wallet_id, original_amount, reversed_amount,
+		state_id, review, created_at, updated_at)
+		VALUES ($1, $2, $3, 0, $4, FALSE, NOW(), NOW())
+		ON CONFLICT (transaction_id) DO NOTHING`,
+		original.TransactionId, original.WalletId, original.Amount, ORIGINAL_STATE_AUTHORIZED)
+	if err != nil {
+		return nil, err
+	}
+
+	// lock the original transaction values
+	orig := new(OriginalTransaction)
+	row := tx.QueryRow(ctx,
+		`SELECT transaction_id, wallet_id, original_amount, reversed_amount, state_id, review, created_at, updated_at
+		FROM 	wallet_transaction_original
+		WHERE	transaction_id = $1 FOR UPDATE`,
+		original.TransactionId)
+	err = row.Scan(&orig.TransactionId, &orig.WalletId, &orig.OriginalAmount, &orig.ReversedAmount,
+				&orig.StateId, &orig.Review, &orig.CreatedAt, &orig.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return orig, nil
+}
+
+
+// Gets the balance move and the transaction operation of a balance
+// movement, and if the move releases a pending credit. Credits pay
+// the wallet debt first, debits without funds are recorded as debt.
+func balanceMovement(movement string) (balanceMove, string, bool, error) {
+	switch movement {
+		case BALANCE_WITHDRAW_AVAILABLE:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.Available -= applied
+				b.Blocked += applied
+			}, TX_OPER_WITHDRAW, false, nil
+		case BALANCE_WITHDRAW_BLOCKED:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.Blocked -= applied
+			}, TX_OPER_INFO, false, nil
+		case BALANCE_DEPOSIT_BLOCKED:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.Blocked += applied
+			}, TX_OPER_INFO, false, nil
+		case BALANCE_RELEASE_PENDING:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.Pending -= applied
+			}, TX_OPER_INFO, false, nil
+		case BALANCE_CREDIT_PENDING:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.Pending -= released
+				b.credit(applied)
+				b.Current += applied
+			}, TX_OPER_DEPOSIT, true, nil
+		case BALANCE_DEBIT_AVAILABLE:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.debit(applied)
+				b.Current -= applied
+			}, TX_OPER_WITHDRAW, false, nil
+		case BALANCE_WITHDRAW_AVAILABLE_DEBT:
+			return func(b *Balances, applied money.Amount, released money.Amount) {
+				b.debit(applied)
+				b.Blocked += applied
+			}, TX_OPER_WITHDRAW, false, nil
+	}
+	return nil, "", false, fmt.Errorf(helpers.GetFunctionName() + "- invalid balance movement=%s", movement)
+}
+
+
+// Get the original transactions flagged for manual review
+func GetReviewOriginals(limit int) ([]OriginalTransaction, error) {
+
+	// get the original transactions
+	rows, err := db.DBRead.Query(context.Background(),
+		`SELECT transaction_id, wallet_id, original_amount, reversed_amount, state_id, review, created_at, updated_at
+		FROM 	wallet_transaction_original
+		WHERE	review = TRUE
+		ORDER BY updated_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+	}
+	defer rows.Close()
+
+	// get values
+	originals := make([]OriginalTransaction, 0)
+	for rows.Next() {
+		var orig OriginalTransaction
+		err = rows.Scan(&orig.TransactionId, &orig.WalletId, &orig.OriginalAmount, &orig.ReversedAmount,
+					&orig.StateId, &orig.Review, &orig.CreatedAt, &orig.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+		}
+		originals = append(originals, orig)
+	}
+
+	return originals, nil
+}
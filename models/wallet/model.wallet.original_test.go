@@ -0,0 +1,257 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package models
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+)
+
+// Property tests iterations and seed
+const (
+	PROPERTY_ITERATIONS 	= 10000
+	PROPERTY_SEED 			= 20220601
+)
+
+
+// Applies a balance movement to a copy of the balances
+func applyMovement(t *testing.T, movement string, b Balances, applied money.Amount, released money.Amount) (Balances, string, bool) {
+	move, txOperation, releases, err := balanceMovement(movement)
+	if err != nil {
+		t.Fatalf("balanceMovement(%s) error=%s", movement, err.Error())
+	}
+	if !releases {
+		released = 0
+	}
+	move(&b, applied, released)
+	return b, txOperation, releases
+}
+
+
+func TestBalanceMovement(t *testing.T) {
+	start := Balances{Current: 1000, Available: 600, Blocked: 300, Pending: 200, Debt: 0}
+	inDebt := Balances{Current: 1000, Available: 0, Blocked: 300, Pending: 200, Debt: 150}
+
+	tests := []struct {
+		name 		string
+		movement 	string
+		balances 	Balances
+		applied 	money.Amount
+		released 	money.Amount
+		expected 	Balances
+		operation 	string
+	}{
+		{"withdraw available", BALANCE_WITHDRAW_AVAILABLE, start, 100, 0,
+			Balances{Current: 1000, Available: 500, Blocked: 400, Pending: 200}, TX_OPER_WITHDRAW},
+		{"withdraw blocked", BALANCE_WITHDRAW_BLOCKED, start, 100, 0,
+			Balances{Current: 1000, Available: 600, Blocked: 200, Pending: 200}, TX_OPER_INFO},
+		{"deposit blocked", BALANCE_DEPOSIT_BLOCKED, start, 100, 0,
+			Balances{Current: 1000, Available: 600, Blocked: 400, Pending: 200}, TX_OPER_INFO},
+		{"release pending", BALANCE_RELEASE_PENDING, start, 100, 0,
+			Balances{Current: 1000, Available: 600, Blocked: 300, Pending: 100}, TX_OPER_INFO},
+		{"credit pending", BALANCE_CREDIT_PENDING, start, 250, 200,
+			Balances{Current: 1250, Available: 850, Blocked: 300, Pending: 0}, TX_OPER_DEPOSIT},
+		{"credit pending pays debt", BALANCE_CREDIT_PENDING, inDebt, 100, 200,
+			Balances{Current: 1100, Available: 0, Blocked: 300, Pending: 0, Debt: 50}, TX_OPER_DEPOSIT},
+		{"credit pending pays all debt", BALANCE_CREDIT_PENDING, inDebt, 250, 200,
+			Balances{Current: 1250, Available: 100, Blocked: 300, Pending: 0, Debt: 0}, TX_OPER_DEPOSIT},
+		{"debit available", BALANCE_DEBIT_AVAILABLE, start, 100, 0,
+			Balances{Current: 900, Available: 500, Blocked: 300, Pending: 200}, TX_OPER_WITHDRAW},
+		{"debit available without funds", BALANCE_DEBIT_AVAILABLE, start, 800, 0,
+			Balances{Current: 200, Available: 0, Blocked: 300, Pending: 200, Debt: 200}, TX_OPER_WITHDRAW},
+		{"withdraw available with debt", BALANCE_WITHDRAW_AVAILABLE_DEBT, start, 100, 0,
+			Balances{Current: 1000, Available: 500, Blocked: 400, Pending: 200}, TX_OPER_WITHDRAW},
+		{"withdraw available without funds", BALANCE_WITHDRAW_AVAILABLE_DEBT, start, 700, 0,
+			Balances{Current: 1000, Available: 0, Blocked: 1000, Pending: 200, Debt: 100}, TX_OPER_WITHDRAW},
+		{"withdraw available in debt", BALANCE_WITHDRAW_AVAILABLE_DEBT, inDebt, 100, 0,
+			Balances{Current: 1000, Available: 0, Blocked: 400, Pending: 200, Debt: 250}, TX_OPER_WITHDRAW},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances, txOperation, _ := applyMovement(t, tt.movement, tt.balances, tt.applied, tt.released)
+			if balances != tt.expected {
+				t.Errorf("balances=%+v, %+v expected", balances, tt.expected)
+			}
+			if txOperation != tt.operation {
+				t.Errorf("operation=%s, %s expected", txOperation, tt.operation)
+			}
+		})
+	}
+
+	// invalid movement
+	_, _, _, err := balanceMovement("XX")
+	if err == nil {
+		t.Errorf("balanceMovement(XX) error expected")
+	}
+}
+
+
+// Every movement changes the balances by exactly the applied and released
+// amounts: the net available balance (available minus debt), blocked,
+// pending and current balances add up, no balance gets negative and
+// a wallet with debt has no available balance
+func TestPropertyBalancesAddUp(t *testing.T) {
+
+	// expected change of the net available, blocked, pending and current
+	// balances by applied amount (a) and released amount (r)
+	type change struct{ net, blocked, pending, current, released int64 }
+	changes := map[string]change{
+		BALANCE_WITHDRAW_AVAILABLE: 		{net: -1, blocked: 1},
+		BALANCE_WITHDRAW_BLOCKED: 			{blocked: -1},
+		BALANCE_DEPOSIT_BLOCKED: 			{blocked: 1},
+		BALANCE_RELEASE_PENDING: 			{pending: -1},
+		BALANCE_CREDIT_PENDING: 			{net: 1, current: 1, released: -1},
+		BALANCE_DEBIT_AVAILABLE: 			{net: -1, current: -1},
+		BALANCE_WITHDRAW_AVAILABLE_DEBT: 	{net: -1, blocked: 1},
+	}
+	debtMovements := map[string]bool{BALANCE_CREDIT_PENDING: true, BALANCE_DEBIT_AVAILABLE: true,
+		BALANCE_WITHDRAW_AVAILABLE_DEBT: true}
+
+	r := rand.New(rand.NewSource(PROPERTY_SEED))
+	for i := 0; i < PROPERTY_ITERATIONS; i++ {
+
+		// a wallet with debt has no available balance
+		b := Balances{Current: money.Amount(r.Int63n(1e9)), Blocked: money.Amount(r.Int63n(1e9)),
+			Pending: money.Amount(r.Int63n(1e9))}
+		if r.Intn(2) == 0 {
+			b.Available = money.Amount(r.Int63n(1e9))
+		} else {
+			b.Debt = money.Amount(r.Int63n(1e9))
+		}
+
+		for movement, c := range changes {
+			applied := money.Amount(r.Int63n(2e9))
+			released := money.Amount(r.Int63n(int64(b.Pending) + 1))
+			if c.blocked < 0 {
+				applied = money.Amount(r.Int63n(int64(b.Blocked) + 1))
+			}
+			if c.pending < 0 {
+				applied = money.Amount(r.Int63n(int64(b.Pending) + 1))
+			}
+			if movement == BALANCE_WITHDRAW_AVAILABLE {
+				applied = money.Amount(r.Int63n(int64(b.Available) + 1))
+			}
+
+			after, _, _ := applyMovement(t, movement, b, applied, released)
+
+			// the balances add up
+			a, rel := int64(applied), int64(released)
+			if int64((after.Available - after.Debt) - (b.Available - b.Debt)) != c.net * a ||
+				int64(after.Blocked - b.Blocked) != c.blocked * a ||
+				int64(after.Pending - b.Pending) != c.pending * a + c.released * rel ||
+				int64(after.Current - b.Current) != c.current * a {
+				t.Fatalf("movement=%s applied=%s released=%s balances=%+v after=%+v do not add up",
+					movement, applied, released, b, after)
+			}
+
+			// no negative balances
+			if after.Available < 0 || after.Blocked < 0 || after.Pending < 0 || after.Debt < 0 {
+				t.Fatalf("movement=%s applied=%s balances=%+v after=%+v has negative balances",
+					movement, applied, b, after)
+			}
+
+			// debt is only carried without available balance
+			if debtMovements[movement] && after.Debt > 0 && after.Available > 0 {
+				t.Fatalf("movement=%s applied=%s balances=%+v after=%+v has debt and available balance",
+					movement, applied, b, after)
+			}
+		}
+	}
+}
+
+
+// A LoadAdjustment after a partial LoadAuthReversal credits the
+// adjustment and releases the pending credit not yet reversed
+func TestAdjustAfterPartialReversal(t *testing.T) {
+	orig := &OriginalTransaction{OriginalAmount: 1000, StateId: ORIGINAL_STATE_AUTHORIZED}
+	b := Balances{Current: 0, Pending: 1000}
+
+	// partial load auth reversal
+	reversed := new(LinkResult)
+	reverseOriginal(NewTxAmount(300))(orig, reversed)
+	b, _, _ = applyMovement(t, BALANCE_RELEASE_PENDING, b, reversed.AppliedAmount, 0)
+	if orig.StateId != ORIGINAL_STATE_PARTIALLY_REVERSED || orig.ReversedAmount != 300 {
+		t.Fatalf("original state=%s reversed=%s, %s and 300 expected", orig.StateId, orig.ReversedAmount,
+			ORIGINAL_STATE_PARTIALLY_REVERSED)
+	}
+
+	// load adjustment of the remaining amount
+	adjusted := new(LinkResult)
+	adjustOriginal(NewTxAmount(700), BALANCE_CREDIT_PENDING)(orig, adjusted)
+	if adjusted.AppliedAmount != 700 || adjusted.ReleasedAmount != 700 || orig.StateId != ORIGINAL_STATE_ADJUSTED {
+		t.Fatalf("applied=%s released=%s state=%s, 700 applied and released and %s expected",
+			adjusted.AppliedAmount, adjusted.ReleasedAmount, orig.StateId, ORIGINAL_STATE_ADJUSTED)
+	}
+	b, _, _ = applyMovement(t, BALANCE_CREDIT_PENDING, b, adjusted.AppliedAmount, adjusted.ReleasedAmount)
+	expected := Balances{Current: 700, Available: 700, Pending: 0}
+	if b != expected {
+		t.Errorf("balances=%+v, %+v expected", b, expected)
+	}
+}
+
+
+// Queues the locked original transaction row of a link
+func originalRow(amount money.Amount, reversed money.Amount, state string) fakeRow {
+	return fakeRow{values: []interface{}{"original-1", "wallet-1", amount, reversed, state, false,
+		pgtype.Timestamp{}, pgtype.Timestamp{}}}
+}
+
+
+// The check is made in the database transaction of the link, a
+// rejected link commits the check records without changing the
+// balances and a failed check rolls back
+func TestLinkTransactionCheck(t *testing.T) {
+	tests := []struct {
+		name 		string
+		check 		LinkCheck
+		rejected 	bool
+		err 		bool
+	}{
+		{"rejected", func(ctx context.Context, tx pgx.Tx, result *LinkResult) error {
+			result.Rejected = true
+			return nil
+		}, true, false},
+		{"check error", func(ctx context.Context, tx pgx.Tx, result *LinkResult) error {
+			return errors.New("transition not recorded")
+		}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &fakeTx{
+				tags: map[string]string{"SET": "SET", "LOCK": PSQL_MSG_LOCK_TABLE, "INSERT": PSQL_MSG_INSERT_1},
+				rows: []fakeRow{originalRow(1000, 0, ORIGINAL_STATE_AUTHORIZED)},
+			}
+			stubTx(t, tx)
+
+			original := &WalletTransaction{TransactionId: "original-1", WalletId: "wallet-1", Amount: 1000}
+			result, err := ReverseTransaction(original, "reversal-1", NewTxAmount(300), BALANCE_WITHDRAW_BLOCKED, tt.check,
+								"DEREV", "Approved", "{}")
+			if (err != nil) != tt.err {
+				t.Fatalf("ReverseTransaction error=%v, error expected=%t", err, tt.err)
+			}
+			if tt.err {
+				if !tx.rolledBack || tx.committed {
+					t.Errorf("rolledBack=%t committed=%t, rollback expected", tx.rolledBack, tx.committed)
+				}
+				return
+			}
+			if result.Rejected != tt.rejected || !tx.committed {
+				t.Errorf("rejected=%t committed=%t, rejected and committed expected", result.Rejected, tx.committed)
+			}
+			for _, sql := range tx.execs {
+				if strings.HasPrefix(sql, "UPDATE") || strings.HasPrefix(sql, "INSERT INTO wallet_transaction_link") {
+					t.Errorf("rejected link executed %q", sql)
+				}
+			}
+		})
+	}
+}
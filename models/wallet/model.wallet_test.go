@@ -0,0 +1,191 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package models
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+)
+
+
+// Fake write transaction, Exec answers the command tag of the
+// statement prefix and QueryRow answers the queued rows in order
+type fakeTx struct {
+	pgx.Tx
+	tags 		map[string]string
+	rows 		[]fakeRow
+	execs 		[]string
+	committed 	bool
+	rolledBack 	bool
+}
+
+// Fake row with the scanned values or the scan error
+type fakeRow struct {
+	values 		[]interface{}
+	err 		error
+}
+
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, strings.TrimSpace(sql))
+	for prefix, tag := range tx.tags {
+		if strings.HasPrefix(strings.TrimSpace(sql), prefix) {
+			return pgconn.CommandTag(tag), nil
+		}
+	}
+	return pgconn.CommandTag(""), nil
+}
+
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if len(tx.rows) == 0 {
+		return fakeRow{err: pgx.ErrNoRows}
+	}
+	row := tx.rows[0]
+	tx.rows = tx.rows[1:]
+	return row
+}
+
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	tx.rolledBack = true
+	return nil
+}
+
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i := range dest {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+
+// Stubs the write transaction with a fake transaction
+func stubTx(t *testing.T, tx *fakeTx) {
+	beginTxOrig := beginTx
+	t.Cleanup(func() { beginTx = beginTxOrig })
+	beginTx = func(ctx context.Context) (pgx.Tx, error) {
+		return tx, nil
+	}
+}
+
+
+// A LoadAuth of an unknown wallet updates no wallet row, it is
+// an error and the transaction is rolled back
+func TestDepositPendingBalanceUnknownWallet(t *testing.T) {
+	tx := &fakeTx{tags: map[string]string{
+		"SET": "SET",
+		"LOCK": PSQL_MSG_LOCK_TABLE,
+		"UPDATE": "UPDATE 0",
+		"INSERT": PSQL_MSG_INSERT_1,
+	}}
+	stubTx(t, tx)
+
+	err := DepositPendingBalance("unknown-wallet", NewTxAmount(1000), "LOAUT", "Approved", "{}")
+	if err == nil || !strings.Contains(err.Error(), "wallet_id=unknown-wallet not updated") {
+		t.Fatalf("DepositPendingBalance error=%v, wallet not updated expected", err)
+	}
+	if !tx.rolledBack || tx.committed {
+		t.Errorf("rolledBack=%t committed=%t, rollback expected", tx.rolledBack, tx.committed)
+	}
+}
+
+
+// Unexpected command tags without error are errors, not panics
+func TestDepositPendingBalanceCommandTags(t *testing.T) {
+	tests := []struct {
+		name 		string
+		tags 		map[string]string
+		message 	string
+	}{
+		{"isolation level not set", map[string]string{"LOCK": PSQL_MSG_LOCK_TABLE}, "transaction isolation level not set"},
+		{"table not locked", map[string]string{"SET": "SET"}, "wallet table not locked"},
+		{"transaction not inserted", map[string]string{"SET": "SET", "LOCK": PSQL_MSG_LOCK_TABLE,
+			"UPDATE": PSQL_MSG_UPDATE_1, "INSERT": "INSERT 0 0"}, "not inserted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &fakeTx{tags: tt.tags}
+			stubTx(t, tx)
+
+			err := DepositPendingBalance("wallet-1", NewTxAmount(1000), "LOAUT", "Approved", "{}")
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("DepositPendingBalance error=%v, %q expected", err, tt.message)
+			}
+			if !tx.rolledBack || tx.committed {
+				t.Errorf("rolledBack=%t committed=%t, rollback expected", tx.rolledBack, tx.committed)
+			}
+		})
+	}
+}
+
+
+// Queues the locked wallet balance, the limits and the usage rows of a withdrawal
+func withdrawRows(balance money.Amount, dailyLimit money.Amount, dailyUsed money.Amount) []fakeRow {
+	return []fakeRow{
+		{values: []interface{}{balance}},
+		{values: []interface{}{"wallet-1", "group-1", money.Amount(0), dailyLimit, money.Amount(0),
+			int64(0), money.Amount(0), int64(0), money.Amount(0)}},
+		{values: []interface{}{dailyUsed, dailyUsed, int64(0), money.Amount(0), int64(0), money.Amount(0)}},
+	}
+}
+
+
+// The spending limits are checked with the usage read in the
+// withdrawal transaction, an exceeded limit withdraws nothing
+func TestWithdrawAvailableBalanceLimits(t *testing.T) {
+	tests := []struct {
+		name 		string
+		dailyUsed 	money.Amount
+		exceeded 	string
+		committed 	bool
+	}{
+		{"within the daily limit", 4000000, "", true},
+		{"over the daily limit", 4500000, LIMIT_DAILY, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &fakeTx{
+				tags: map[string]string{
+					"SET": "SET",
+					"LOCK": PSQL_MSG_LOCK_TABLE,
+					"UPDATE": PSQL_MSG_UPDATE_1,
+					"INSERT": PSQL_MSG_INSERT_1,
+				},
+				rows: withdrawRows(10000000, 5000000, tt.dailyUsed),
+			}
+			stubTx(t, tx)
+
+			limitCheck := &LimitCheck{CardId: "card-1", TxTypes: []string{"DEDUC"}}
+			exceeded, err := WithdrawAvailableBalance("wallet-1", NewTxAmount(1000000), 10000000, limitCheck,
+								"DEDUC", "Approved", "{}")
+			if err != nil {
+				t.Fatalf("WithdrawAvailableBalance error=%v", err)
+			}
+			if exceeded != tt.exceeded {
+				t.Errorf("exceeded=%q, %q expected", exceeded, tt.exceeded)
+			}
+			if tx.committed != tt.committed || tx.rolledBack == tt.committed {
+				t.Errorf("committed=%t rolledBack=%t, committed=%t expected", tx.committed, tx.rolledBack, tt.committed)
+			}
+		})
+	}
+}
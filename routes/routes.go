@@ -28,8 +28,92 @@ func Set(app *fiber.App) error {
 		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
 	}
 
+	// Admin routes, every route requires the admin token
+	admin := app.Group("/authorizer/api/v1/admin", handlers.AdminAuthHandler)
+	if admin == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
 	// Route that gets the service information
-	fr = app.Get("/authorizer/api/v1/admin/about", handlers.AdminAboutServiceHandler)
+	fr = admin.Get("/about", handlers.AdminAboutServiceHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the Paymentology administrative messages
+	fr = admin.Get("/messages", handlers.AdminMessagesHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the registered Paymentology methods
+	fr = admin.Get("/methods", handlers.AdminMethodsHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the checksum keys usage
+	fr = admin.Get("/checksum-keys", handlers.AdminChecksumKeysHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the retried requests
+	fr = admin.Get("/retries", handlers.AdminRetriesHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the original transactions flagged for review
+	fr = admin.Get("/transactions/review", handlers.AdminReviewOriginalsHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the parked reversals
+	fr = admin.Get("/reversals/parked", handlers.AdminParkedReversalsHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets an authorization lifecycle
+	fr = admin.Get("/authorizations/:txid", handlers.AdminAuthorizationHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the wallets with debt
+	fr = admin.Get("/wallets/debt", handlers.AdminDebtWalletsHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the wallet spending limits
+	fr = admin.Get("/wallets/:walletid/limits", handlers.AdminWalletLimitsHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that gets the MCC rules
+	fr = admin.Get("/mcc-rules", handlers.AdminMCCRulesHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that adds a MCC rule
+	fr = admin.Post("/mcc-rules", handlers.AdminAddMCCRuleHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that deletes a MCC rule
+	fr = admin.Delete("/mcc-rules/:ruleid", handlers.AdminDeleteMCCRuleHandler)
+	if fr == nil{
+		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
+	}
+
+	// Route that sets a card PIN
+	fr = admin.Put("/cards/:cardid/pin", handlers.AdminSetCardPINHandler)
 	if fr == nil{
 		return fmt.Errorf(CANNOT_SET_ROUTE, helpers.GetFunctionName())
 	}
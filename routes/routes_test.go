@@ -0,0 +1,114 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package routes
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	"github.com/kueski-dev/paymentology-paymethods/handlers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+)
+
+
+// Every admin route requires the admin token, the token is checked
+// before the route handler is called
+func TestAdminRoutesRequireToken(t *testing.T) {
+	adminAPITokenOrig := configs.AdminAPIToken
+	t.Cleanup(func() { configs.AdminAPIToken = adminAPITokenOrig })
+	configs.AdminAPIToken = "admin-token"
+
+	err := logger.Start(os.DevNull, "routes-test")
+	if err != nil {
+		t.Fatalf("logger Start error=%s", err.Error())
+	}
+
+	app := fiber.New()
+	err = Set(app)
+	if err != nil {
+		t.Fatalf("Set error=%s", err.Error())
+	}
+
+	routes := []struct {
+		method 		string
+		path 		string
+	}{
+		{fiber.MethodGet, "/authorizer/api/v1/admin/about"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/messages"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/methods"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/checksum-keys"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/retries"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/transactions/review"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/reversals/parked"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/authorizations/tx-1"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/wallets/debt"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/wallets/wallet-1/limits"},
+		{fiber.MethodGet, "/authorizer/api/v1/admin/mcc-rules"},
+		{fiber.MethodPost, "/authorizer/api/v1/admin/mcc-rules"},
+		{fiber.MethodDelete, "/authorizer/api/v1/admin/mcc-rules/rule-1"},
+		{fiber.MethodPut, "/authorizer/api/v1/admin/cards/card-1/pin"},
+	}
+	tokens := []string{"", "admin-token", "Bearer other-token", "Bearer "}
+
+	for _, route := range routes {
+		for _, token := range tokens {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			if token != "" {
+				req.Header.Set(fiber.HeaderAuthorization, token)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("%s %s error=%s", route.method, route.path, err.Error())
+			}
+			if resp.StatusCode != fiber.StatusUnauthorized {
+				t.Errorf("%s %s authorization=%q status=%d, %d expected", route.method, route.path, token,
+					resp.StatusCode, fiber.StatusUnauthorized)
+			}
+		}
+	}
+
+	// a valid token reaches the route handler
+	req := httptest.NewRequest(fiber.MethodGet, "/authorizer/api/v1/admin/about", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer admin-token")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Errorf("GET /authorizer/api/v1/admin/about with token status=%v error=%v, %d expected", resp, err, fiber.StatusOK)
+	}
+}
+
+
+// A request body that is not a XML-RPC method call is
+// answered with a parse error fault
+func TestAuthorizerParseError(t *testing.T) {
+	err := logger.Start(os.DevNull, "routes-test")
+	if err != nil {
+		t.Fatalf("logger Start error=%s", err.Error())
+	}
+
+	app := fiber.New()
+	err = Set(app)
+	if err != nil {
+		t.Fatalf("Set error=%s", err.Error())
+	}
+
+	bodies := []string{
+		"<methodCall>",
+		"<methodCall><methodName>Deduct</methodName><params><param><value>",
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest(fiber.MethodPost, "/authorizer/api/v1/pmtol/xmlrpc", strings.NewReader(body))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("POST xmlrpc body=%q error=%s", body, err.Error())
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		if string(respBody) != handlers.RESPONSE_BODY_PARSE_ERROR {
+			t.Errorf("POST xmlrpc body=%q response=%s, %s expected", body, respBody, handlers.RESPONSE_BODY_PARSE_ERROR)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"fmt"
+	"strings"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	memdb "github.com/kueski-dev/paymentology-paymethods/models/memdb"
+)
+
+// KLV field with the card last four digits
+const KLV_LAST_FOUR_PAN = "LastfourDigitsPAN"
+
+
+// Function IsATM checks if the decoded KLV data is an ATM cash
+// withdrawal, by the terminal type or the transaction type fields
+// configured in PMTOL_ATM_TERMINAL_TYPE_FIELD and
+// PMTOL_ATM_TRANSACTION_TYPE_FIELD. A request without any of
+// them is logged, it cannot be detected as ATM cash withdrawal.
+func IsATM(txID string, txData *map[string]string) bool {
+	var terminalType, txType string
+	var hasTerminalType, hasTxType bool
+	if txData != nil {
+		terminalType, hasTerminalType = (*txData)[configs.ATMTerminalTypeField]
+		txType, hasTxType = (*txData)[configs.ATMTransactionTypeField]
+	}
+	if !hasTerminalType && !hasTxType {
+		logger.LogWarning(fmt.Sprintf("%s - tx-id=%s without %s and %s KLV fields, not checked as ATM cash withdrawal",
+			helpers.GetFunctionName(), txID, configs.ATMTerminalTypeField, configs.ATMTransactionTypeField))
+		return false
+	}
+
+	// check terminal type and transaction type
+	terminalType, txType = strings.TrimSpace(terminalType), strings.TrimSpace(txType)
+	for _, atmType := range configs.ATMTerminalTypes {
+		if strings.EqualFold(terminalType, atmType) {
+			return true
+		}
+	}
+	for _, atmPrefix := range configs.ATMTransactionTypes {
+		if txType != "" && strings.HasPrefix(txType, atmPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+
+// Function CheckATMFields checks the ATM detection KLV fields are
+// in the pmtol_klvmap table, a missing field is logged
+func CheckATMFields() {
+	for _, field := range []string{configs.ATMTerminalTypeField, configs.ATMTransactionTypeField} {
+		found, err := memdb.IsKLVName(field)
+		if err != nil {
+			logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+			continue
+		}
+		if !found {
+			logger.LogWarning(fmt.Sprintf("%s - ATM KLV field %s is not in pmtol_klvmap", helpers.GetFunctionName(), field))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import (
+	"os"
+	"testing"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+)
+
+
+func TestIsATM(t *testing.T) {
+	err := logger.Start(os.DevNull, "commons-test")
+	if err != nil {
+		t.Fatalf("logger Start error=%s", err.Error())
+	}
+
+	tests := []struct {
+		name 		string
+		txData 		*map[string]string
+		atm 		bool
+	}{
+		{"atm terminal", &map[string]string{"TerminalType": "atm"}, true},
+		{"pos terminal", &map[string]string{"TerminalType": "POS"}, false},
+		{"cash withdrawal", &map[string]string{"TransactionType": "010000"}, true},
+		{"purchase", &map[string]string{"TransactionType": "000000", "TerminalType": "POS"}, false},
+		{"empty fields", &map[string]string{"TransactionType": "", "TerminalType": ""}, false},
+		{"without fields", &map[string]string{"LastfourDigitsPAN": "1234"}, false},
+		{"without data", nil, false},
+	}
+
+	for _, tt := range tests {
+		if IsATM("tx-1", tt.txData) != tt.atm {
+			t.Errorf("%s: IsATM=%t, %t expected", tt.name, !tt.atm, tt.atm)
+		}
+	}
+}
+
+
+func TestIsATMConfigured(t *testing.T) {
+	err := logger.Start(os.DevNull, "commons-test")
+	if err != nil {
+		t.Fatalf("logger Start error=%s", err.Error())
+	}
+
+	terminalTypeField, terminalTypes := configs.ATMTerminalTypeField, configs.ATMTerminalTypes
+	txTypeField, txTypes := configs.ATMTransactionTypeField, configs.ATMTransactionTypes
+	t.Cleanup(func() {
+		configs.ATMTerminalTypeField, configs.ATMTerminalTypes = terminalTypeField, terminalTypes
+		configs.ATMTransactionTypeField, configs.ATMTransactionTypes = txTypeField, txTypes
+	})
+	configs.ATMTerminalTypeField, configs.ATMTerminalTypes = "PosTerminalType", []string{"ATM", "CASH"}
+	configs.ATMTransactionTypeField, configs.ATMTransactionTypes = "ProcessingCode", []string{"01", "17"}
+
+	tests := []struct {
+		name 		string
+		txData 		*map[string]string
+		atm 		bool
+	}{
+		{"configured terminal type", &map[string]string{"PosTerminalType": "CASH"}, true},
+		{"configured transaction type", &map[string]string{"ProcessingCode": "170000"}, true},
+		{"other transaction type", &map[string]string{"ProcessingCode": "000000"}, false},
+		{"default fields", &map[string]string{"TerminalType": "ATM", "TransactionType": "010000"}, false},
+	}
+
+	for _, tt := range tests {
+		if IsATM("tx-1", tt.txData) != tt.atm {
+			t.Errorf("%s: IsATM=%t, %t expected", tt.name, !tt.atm, tt.atm)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"crypto/hmac"
+	"sort"
+	"sync"
+	"time"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+)
+
+// Checksum key usage struct
+type ChecksumKeyUsage struct {
+	TerminalId 		string		`json:"terminal-id"`
+	KeyId 			string		`json:"key-id"`
+	ValidFrom 		time.Time	`json:"valid-from"`
+	ValidTo 		time.Time	`json:"valid-to"`
+	Active 			bool		`json:"active"`
+	Verified 		int64		`json:"verified"`
+	LastVerified 	time.Time	`json:"last-verified"`
+}
+
+// checksum key usage counters by terminal and key id
+var (
+	keyUsage = make(map[string]*ChecksumKeyUsage)
+	keyUsageMutex sync.Mutex
+)
+
+
+// Function IsTerminal checks if the terminal is configured
+func IsTerminal(terminalID string) bool {
+	_, ok := configs.PaymentologyTerminals[terminalID]
+	return ok
+}
+
+
+// Function VerifyCheckSum verifies the checksum with the active
+// terminal keys in order, using a constant time comparison.
+// Returns the id of the key that verified the checksum.
+func VerifyCheckSum(terminalID string, data string, checksum string) (string, bool) {
+	now := time.Now().UTC()
+
+	for _, key := range configs.PaymentologyTerminals[terminalID] {
+		// skip keys out of their validity window
+		if !key.IsActive(now) {
+			continue
+		}
+		if hmac.Equal([]byte(GetCheckSum(data, []byte(key.Passwd))), []byte(checksum)) {
+			countKeyUsage(terminalID, key.KeyId, now)
+			return key.KeyId, true
+		}
+	}
+
+	return "", false
+}
+
+
+// Counts a verification made with a terminal key
+func countKeyUsage(terminalID string, keyID string, at time.Time) {
+	keyUsageMutex.Lock()
+	defer keyUsageMutex.Unlock()
+
+	usage, ok := keyUsage[terminalID + "/" + keyID]
+	if !ok {
+		usage = &ChecksumKeyUsage{TerminalId: terminalID, KeyId: keyID}
+		keyUsage[terminalID + "/" + keyID] = usage
+	}
+	usage.Verified += 1
+	usage.LastVerified = at
+}
+
+
+// Function GetChecksumKeysUsage gets the configured terminal keys
+// with the number of requests verified with each key since start
+func GetChecksumKeysUsage() []ChecksumKeyUsage {
+	now := time.Now().UTC()
+
+	keyUsageMutex.Lock()
+	defer keyUsageMutex.Unlock()
+
+	list := make([]ChecksumKeyUsage, 0)
+	for terminalID, keys := range configs.PaymentologyTerminals {
+		for _, key := range keys {
+			usage := ChecksumKeyUsage{TerminalId: terminalID, KeyId: key.KeyId}
+			if counter, ok := keyUsage[terminalID + "/" + key.KeyId]; ok {
+				usage = *counter
+			}
+			usage.ValidFrom, usage.ValidTo, usage.Active = key.ValidFrom, key.ValidTo, key.IsActive(now)
+			list = append(list, usage)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TerminalId == list[j].TerminalId {
+			return list[i].KeyId < list[j].KeyId
+		}
+		return list[i].TerminalId < list[j].TerminalId
+	})
+
+	return list
+}
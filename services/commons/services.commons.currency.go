@@ -0,0 +1,188 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	memdb "github.com/kueski-dev/paymentology-paymethods/models/memdb"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+)
+
+// KLV field with the transaction currency ISO 4217 numeric code
+const KLV_TX_CURRENCY_CODE = "TransactionCurrencyCode"
+
+// Currency exponent of the amounts without a known currency
+const CURRENCY_DEFAULT_EXPONENT = 2
+
+// Currency lookup in the pmtol_currency memory table
+var lookupCurrency = func(currencyCode string) (interface{}, error) {
+	return memdb.GetFirstByIndex("pmtol_currency", currencyCode)
+}
+
+// Mapped request with amount interface
+type AmountRequest interface {
+	Request
+	Amount() *ReqAmount
+}
+
+
+// Function CurrencyExponent gets the ISO 4217 exponent of a
+// currency numeric code, returns false when it is not found
+func CurrencyExponent(currencyCode string) (int, bool) {
+	if currencyCode == "" {
+		return 0, false
+	}
+	mRow, err := lookupCurrency(currencyCode)
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return 0, false
+	}
+	if mRow == nil {
+		return 0, false
+	}
+	return mRow.(memdb.Currency).Exponent, true
+}
+
+
+// Function Amount gets the request amount
+func (a *ReqAmount) Amount() *ReqAmount {
+	return a
+}
+
+
+// Function Parse sets the request amount from a Paymentology amount in
+// minor units of the transaction currency, a currency not found uses
+// the default exponent until the wallet currency is checked
+func (a *ReqAmount) Parse(minorAmount string, currencyCode string) error {
+	var err error
+
+	// parse minor units
+	a.MinorAmount, err = money.ParseMinorUnits(minorAmount)
+	if err != nil {
+		return RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	a.CurrencyCode = currencyCode
+
+	// scale with the currency exponent
+	exponent, ok := CurrencyExponent(currencyCode)
+	if !ok {
+		exponent = CURRENCY_DEFAULT_EXPONENT
+	}
+	a.OriginalAmount, err = money.FromMinorUnits(a.MinorAmount, exponent)
+	if err != nil {
+		return RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	a.RequestAmount = a.OriginalAmount
+
+	return nil
+}
+
+
+// Function TxAmount gets the wallet transaction amount, the request
+// amount with the original amount in the transaction currency
+func (a *ReqAmount) TxAmount() wallet.TxAmount {
+	return wallet.TxAmount{Amount: a.RequestAmount, OriginalAmount: a.OriginalAmount,
+		OriginalCurrency: a.CurrencyCode, Review: a.CurrencyReview}
+}
+
+
+// Function ConvertCurrency sets the request amount in the wallet currency,
+// requests without currency are in the wallet currency. A request in other
+// currency is converted with the configured rate when the mismatch action is
+// convert, returns false when the request must be declined. Currencies not
+// found in the currency table are declined. The amounts are always computed
+// from the minor units received, converting twice is safe.
+func ConvertCurrency(reqAmount *ReqAmount, walletCurrency string) (bool, error) {
+	var err error
+
+	// get the transaction currency exponent
+	if reqAmount.CurrencyCode == "" {
+		reqAmount.CurrencyCode = walletCurrency
+	}
+	exponent, ok := CurrencyExponent(reqAmount.CurrencyCode)
+	if !ok {
+		return false, nil
+	}
+	reqAmount.OriginalAmount, err = money.FromMinorUnits(reqAmount.MinorAmount, exponent)
+	if err != nil {
+		return false, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// same currency
+	if reqAmount.CurrencyCode == walletCurrency {
+		reqAmount.RequestAmount = reqAmount.OriginalAmount
+		return true, nil
+	}
+
+	// get the exchange rate
+	if configs.CurrencyMismatchAction != configs.CURRENCY_MISMATCH_CONVERT {
+		return false, nil
+	}
+	rate, ok := configs.CurrencyRates[configs.CurrencyPair(reqAmount.CurrencyCode, walletCurrency)]
+	if !ok {
+		return false, nil
+	}
+	walletExponent, ok := CurrencyExponent(walletCurrency)
+	if !ok {
+		return false, nil
+	}
+
+	// convert amount
+	converted, err := reqAmount.OriginalAmount.Convert(rate, walletExponent)
+	if err != nil {
+		return false, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	reqAmount.RequestAmount = converted
+
+	return true, nil
+}
+
+
+// Function ConvertAdviceCurrency sets the amount of an advice message in
+// the wallet currency, advice messages notify a transaction already made
+// and are never declined. A currency mismatch is converted with the
+// configured rate, without rate the minor units received are booked in the
+// wallet currency exponent, the amount received is only kept as the original
+// amount. Both are flagged for review when the request would be declined,
+// returns false in that case. Without wallet currency exponent 0 is booked.
+func ConvertAdviceCurrency(reqAmount *ReqAmount, walletCurrency string) (bool, error) {
+
+	// convert as a request
+	approved, err := ConvertCurrency(reqAmount, walletCurrency)
+	if err != nil || approved {
+		return approved, err
+	}
+	reqAmount.CurrencyReview = true
+
+	// get the wallet currency exponent
+	walletExponent, ok := CurrencyExponent(walletCurrency)
+	if !ok {
+		reqAmount.RequestAmount = 0
+		return false, nil
+	}
+
+	// convert with the configured rate
+	rate, ok := configs.CurrencyRates[configs.CurrencyPair(reqAmount.CurrencyCode, walletCurrency)]
+	if ok {
+		converted, err := reqAmount.OriginalAmount.Convert(rate, walletExponent)
+		if err != nil {
+			return false, RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		reqAmount.RequestAmount = converted
+		return false, nil
+	}
+
+	// book the minor units received in the wallet currency exponent
+	booked, err := money.FromMinorUnits(reqAmount.MinorAmount, walletExponent)
+	if err != nil {
+		return false, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	reqAmount.RequestAmount = booked
+
+	return false, nil
+}
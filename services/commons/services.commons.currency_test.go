@@ -0,0 +1,80 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import (
+	"math/big"
+	"os"
+	"strconv"
+	"testing"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	memdb "github.com/kueski-dev/paymentology-paymethods/models/memdb"
+)
+
+
+// Stubs the currency lookup with a currency table
+func stubCurrencies(t *testing.T, currencies ...memdb.Currency) {
+	lookupCurrencyOrig := lookupCurrency
+	t.Cleanup(func() { lookupCurrency = lookupCurrencyOrig })
+	lookupCurrency = func(currencyCode string) (interface{}, error) {
+		for _, currency := range currencies {
+			if currency.NumericCode == currencyCode {
+				return currency, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+
+// Advice messages that would be declined are converted with the rate,
+// without rate the minor units are booked in the wallet exponent
+func TestConvertAdviceCurrency(t *testing.T) {
+	logger.Start(os.DevNull, "currency-test")
+	stubCurrencies(t,
+		memdb.Currency{NumericCode: "392", AlphaCode: "JPY", Exponent: 0},
+		memdb.Currency{NumericCode: "484", AlphaCode: "MXN", Exponent: 2},
+		memdb.Currency{NumericCode: "840", AlphaCode: "USD", Exponent: 2},
+		memdb.Currency{NumericCode: "048", AlphaCode: "BHD", Exponent: 3})
+	rate, _ := new(big.Rat).SetString("17.0512")
+	ratesOrig := configs.CurrencyRates
+	t.Cleanup(func() { configs.CurrencyRates = ratesOrig })
+	configs.CurrencyRates = map[string]*big.Rat{configs.CurrencyPair("840", "484"): rate}
+
+	tests := []struct {
+		name 			string
+		minorAmount 	int64
+		currency 		string
+		wallet 			string
+		booked 			money.Amount
+		original 		money.Amount
+	}{
+		{"converted with the rate", 1000, "840", "484", 170510, 10000},
+		{"no rate to a larger exponent", 1500, "392", "484", 15000, 1500000},
+		{"no rate to a smaller exponent", 1500, "048", "484", 15000, 1500},
+		{"unknown transaction currency", 1500, "999", "484", 15000, 15000},
+		{"unknown wallet currency", 1500, "484", "999", 0, 15000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqAmount := &ReqAmount{}
+			err := reqAmount.Parse(strconv.FormatInt(tt.minorAmount, 10), tt.currency)
+			if err != nil {
+				t.Fatalf("Parse error=%s", err.Error())
+			}
+
+			approved, err := ConvertAdviceCurrency(reqAmount, tt.wallet)
+			if err != nil || approved {
+				t.Fatalf("ConvertAdviceCurrency approved=%t error=%v, flagged for review expected", approved, err)
+			}
+			if reqAmount.RequestAmount != tt.booked || reqAmount.OriginalAmount != tt.original || !reqAmount.CurrencyReview {
+				t.Errorf("booked=%s original=%s review=%t, booked=%s original=%s review expected", reqAmount.RequestAmount,
+					reqAmount.OriginalAmount, reqAmount.CurrencyReview, tt.booked, tt.original)
+			}
+		})
+	}
+}
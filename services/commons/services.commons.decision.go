@@ -0,0 +1,64 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+// Authorization decision struct, it is returned by the
+// services and converted to a response by the transport
+type Decision struct {
+	ResultCode 		string 		`json:"result-code"`
+	BalanceAmount 	*int64 		`json:"balance-amount,omitempty"`
+	TxID 			string 		`json:"-"`		// set when the decision was made by a method handler
+	TerminalID 		string 		`json:"-"`		// terminal of the request, set with the tx-id
+	Response 		string 		`json:"-"`		// stored response of a retried request
+}
+
+
+// Function NewDecision creates a decision with a result code
+func NewDecision(resultCode string) *Decision {
+	return &Decision{ResultCode: resultCode}
+}
+
+
+// Function NewBalanceDecision creates a decision with a result
+// code and the balance amount in minor units
+func NewBalanceDecision(resultCode string, balanceAmount int64) *Decision {
+	return &Decision{ResultCode: resultCode, BalanceAmount: &balanceAmount}
+}
+
+
+// Function IsApproved checks if the decision was approved
+func (d *Decision) IsApproved() bool {
+	return d.ResultCode == RESP_CODE_APPROVED
+}
+
+
+// Function BuildDecisionResp converts a decision to a XML-RPC response
+func BuildDecisionResp(decision *Decision) *Resp {
+	if decision.BalanceAmount != nil {
+		return BuildBalanceResp(decision.ResultCode, *decision.BalanceAmount)
+	}
+	return BuildSingleIntResp(decision.ResultCode)
+}
+
+
+// Function NewReplayDecision creates a decision with the
+// stored response of a retried request
+func NewReplayDecision(response string) *Decision {
+	return &Decision{Response: response}
+}
+
+
+// Function IsReplay checks if the decision has a stored response
+func (d *Decision) IsReplay() bool {
+	return d.Response != ""
+}
+
+
+// Function IsFinal checks if the decision is the final answer of
+// the request, a timeout is sent while the first request is still
+// in process and it is not the final answer
+func (d *Decision) IsFinal() bool {
+	return d.ResultCode != RESP_CODE_TX_TIMEOUT
+}
@@ -0,0 +1,24 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import "testing"
+
+
+func TestDecisionIsFinal(t *testing.T) {
+	tests := []struct {
+		resultCode 	string
+		final 		bool
+	}{
+		{RESP_CODE_APPROVED, true},
+		{RESP_CODE_DO_NOT_HONOR, true},
+		{RESP_CODE_TX_TIMEOUT, false},
+	}
+
+	for _, tt := range tests {
+		if NewDecision(tt.resultCode).IsFinal() != tt.final {
+			t.Errorf("Decision(%s).IsFinal()=%t, %t expected", tt.resultCode, !tt.final, tt.final)
+		}
+	}
+}
@@ -13,9 +13,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 	"encoding/xml"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
-	"github.com/kueski-dev/paymentology-paymethods/configs"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
 	memdb "github.com/kueski-dev/paymentology-paymethods/models/memdb"
 )
 
@@ -71,8 +72,16 @@ const(
 	TX_TYPE_LOAD_AUTH_REVERSAL = "LOARE"
 	TX_TYPE_LOAD_AUTH = "LOAUT"
 	TX_TYPE_CARD_STOP = "CRDST"
+	TX_TYPE_BALANCE = "BALAN"
+	TX_TYPE_VALIDATE_PIN = "VAPIN"
 )
 
+// Transaction types counted in the wallet spending limits
+var LIMIT_TX_TYPES = []string{TX_TYPE_DEDUCT}
+
+// KLV field with the merchant category code (MCC)
+const KLV_MERCHANT_CATEGORY_CODE = "MerchantCategoryCode"
+
 // Transaction operations
 const (
 	TX_OPER_INFO		= "I"
@@ -89,10 +98,7 @@ type ReqParamsTag struct {
 	TagParam []ReqParam `xml:"param"`
 }
 type ReqParam struct {
-	TagValue ValueStr `xml:"value"`
-}
-type ValueStr struct {
-	Value string `xml:",any"`
+	TagValue Value `xml:"value"`
 }
 
 
@@ -103,62 +109,89 @@ type XMLReqRouter struct {
 }
 
 
-// Request JSON struct
-type ReqJSON struct {
+// Request header JSON struct, shared by all the requests
+type ReqHeader struct {
 	MethodName 		string 				`json:"method-name"`
 	TerminalId  	string				`json:"terminal-id"`
 	Reference  		string				`json:"reference"`
-	RequestAmount	float64				`json:"request-amount"`
-	Narrative  		string				`json:"narrative"`
-	TxType			string				`json:"tx-type"`
 	TxData  		*map[string]string 	`json:"tx-data"`
 	TxID  			string				`json:"tx-id"`
 	TxDate  		string				`json:"tx-date"`
+	TxTime  		time.Time			`json:"tx-time"`
 	Checksum 		string				`json:"checksum"`
+	ProgramId 		string				`json:"-"`
+}
+
+// Mapped request interface
+type Request interface {
+	Header() *ReqHeader
+}
+
+// Request amount JSON struct, the request amount is in the wallet
+// currency and the original amount in the transaction currency.
+// Advice messages booked without a valid conversion are flagged
+// for review
+type ReqAmount struct {
+	MinorAmount		int64				`json:"minor-amount"`
+	RequestAmount	money.Amount		`json:"request-amount"`
+	OriginalAmount	money.Amount		`json:"original-amount"`
+	CurrencyCode	string				`json:"currency-code"`
+	CurrencyReview	bool				`json:"currency-review,omitempty"`
+}
+
+// Request JSON struct
+type ReqJSON struct {
+	ReqHeader
+	ReqAmount
+	Narrative  		string				`json:"narrative"`
+	TxType			string				`json:"tx-type"`
+	ATM				bool				`json:"atm"`
+	CardId			string				`json:"card-id,omitempty"`
 }
 // Request with reference JSON struct
 type ReqWithRefJSON struct {
-	MethodName 		string 				`json:"method-name"`
-	TerminalId  	string				`json:"terminal-id"`
-	Reference  		string				`json:"reference"`
-	RequestAmount	float64				`json:"request-amount"`
+	ReqHeader
+	ReqAmount
 	Narrative  		string				`json:"narrative"`
-	TxData  		*map[string]string 	`json:"tx-data"`
 	ReferenceID  	string				`json:"reference-id"`
 	ReferenceDate  	string				`json:"reference-date"`
-	TxID  			string				`json:"tx-id"`
-	TxDate  		string				`json:"tx-date"`
-	Checksum 		string				`json:"checksum"`
+}
+// Balance request JSON struct
+type BalanceReqJSON struct {
+	ReqHeader
+}
+// Validate PIN request JSON struct, the card number
+// and the PIN block are never converted to JSON
+type PINReqJSON struct {
+	ReqHeader
+	CardNumber 		string				`json:"-"`
+	PINBlock 		string				`json:"-"`
+	Last4 			string				`json:"last-four"`
+}
+// Administrative message request JSON struct
+type AdminMsgReqJSON struct {
+	ReqHeader
+	MessageType 	string				`json:"message-type"`
+	Message 		string				`json:"message"`
 }
 // Stop Card request JSON struct
 type StopReqJSON struct {
-	MethodName 		string 				`json:"method-name"`
-	TerminalId  	string				`json:"terminal-id"`
-	Reference  		string				`json:"reference"`
+	ReqHeader
 	VoucherNumber 	string				`json:"voucher-number"`
 	StopReason 		string				`json:"stop-reason"`
-	TxData        	*map[string]string 	`json:"tx-data"`
-	TxID  			string				`json:"tx-id"`
-	TxDate  		string				`json:"tx-date"`
-	Checksum 		string				`json:"checksum"`
 }
 
-// Single integer response struct
-type RespSingleInt struct {
-	XMLName   xml.Name               	`xml:"methodResponse"`
-	TagParams [1]RespSingleIntMember 	`xml:"params>param>value>struct>member"`
+// Function Header gets the request header
+func (h *ReqHeader) Header() *ReqHeader {
+	return h
 }
-type RespSingleIntMember struct {
-	Name  string 						`xml:"name"`
-	Value string 						`xml:"value>int"`
-}
-
 
 // Function GetCheckSum builds the checksum value
-func GetCheckSum(data string) string {
+// with the terminal password
+func GetCheckSum(data string, passwd []byte) string {
 
 	// Create a new HMAC by defining the hash type and the key (as byte array)
-	h := hmac.New(sha256.New, configs.PaymentologyTerminalPasswd)
+	h := hmac.New(sha256.New, passwd)
 
 	// Write Data to it
 	h.Write([]byte(data))
@@ -185,6 +218,11 @@ func DecodeKLV(klv string) (*map[string]string, error) {
 	// Create map iterating the KLV string
 	for i := 0; i < len(klv); {
 
+		// check truncated key and length values
+		if i + 5 > len(klv) {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- truncated klv data at position %d", i)
+		}
+
 		// get key index value
 		keyIndex = klv[i:(i + 3)]
 		// get other values from the memdb and check for error
@@ -204,14 +242,14 @@ func DecodeKLV(klv string) (*map[string]string, error) {
 			kv.KeyDescrp = "UNKNOWN"
 		}
 
-		// transform memRow to KLV struct
-		kv = mRow.(memdb.KLV)
-
 		// transform key length to integer and check for errors
 		keylen, err = strconv.Atoi(klv[(i + 3):(i + 5)])
 		if err != nil {
 			return nil, err
 		}
+		if keylen < 0 || i + 5 + keylen > len(klv) {
+			return nil, fmt.Errorf(helpers.GetFunctionName() + "- invalid klv length at position %d", i)
+		}
 		// Check for no length values and assign value
 		if keylen > 0 {
 			klvmap[kv.KeyName] = klv[(i + 5):(i + 5 + keylen)]
@@ -236,19 +274,6 @@ func StrMaptoJSON(strmap map[string]string) (string, error) {
 }
 
 
-// Function BuildSingleIntResp create a single int response
-func BuildSingleIntResp(resultCode string) *RespSingleInt {
-
-	// Create struct tag
-	methodResp := new(RespSingleInt)
-
-	methodResp.TagParams[0].Name = "resultCode"
-	methodResp.TagParams[0].Value = resultCode
-
-	return methodResp
-}
-
-
 // Function RaiseError create a custom error
 func RaiseError(source string, msg string) error {
 	// build and return error
@@ -256,108 +281,174 @@ func RaiseError(source string, msg string) error {
 }
 
 
-func MapReqToJSON(req *Req) (*ReqJSON, string, error) {
+// Function MapReqToJSON maps a request with amount
+func MapReqToJSON(req *Req) (*ReqJSON, error) {
 	var err error
 
 	// map values
 	reqJS := new(ReqJSON)
 	reqJS.MethodName = req.MethodName
-	reqJS.TerminalId = req.TagParams.TagParam[0].TagValue.Value
-	reqJS.Reference = req.TagParams.TagParam[1].TagValue.Value
-	strAmount := req.TagParams.TagParam[2].TagValue.Value
-	reqJS.Narrative = req.TagParams.TagParam[3].TagValue.Value
-	reqJS.TxType = req.TagParams.TagParam[4].TagValue.Value
-	txData := req.TagParams.TagParam[5].TagValue.Value
-	reqJS.TxID = req.TagParams.TagParam[6].TagValue.Value
-	reqJS.TxDate = req.TagParams.TagParam[7].TagValue.Value
-	reqJS.Checksum = req.TagParams.TagParam[8].TagValue.Value
-
-	// convert amount to float
-	reqJS.RequestAmount, err = AmountToFloat(strAmount)
+	reqJS.TerminalId = GetParamStr(req, 0)
+	reqJS.Reference = GetParamStr(req, 1)
+	strAmount := GetParamStr(req, 2)
+	reqJS.Narrative = GetParamStr(req, 3)
+	reqJS.TxType = GetParamStr(req, 4)
+	txData := GetParamStr(req, 5)
+	reqJS.TxID = GetParamStr(req, 6)
+	reqJS.TxDate = GetParamStr(req, 7)
+	reqJS.Checksum = GetParamStr(req, 8)
+
+	// decode KLV data
+	reqJS.TxData, err = DecodeKLV(txData)
+	if err != nil {
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// parse amount in minor units of the transaction currency
+	err = reqJS.Parse(strAmount, (*reqJS.TxData)[KLV_TX_CURRENCY_CODE])
 	if err != nil {
-		return nil, "", RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 
+	return reqJS, nil
+}
+
+
+// Function MapReqWithRefToJSON maps a request with amount
+// and a reference to an original transaction
+func MapReqWithRefToJSON(req *Req) (*ReqWithRefJSON, error) {
+	var err error
+
+	// map values
+	reqJS := new(ReqWithRefJSON)
+	reqJS.MethodName = req.MethodName
+	reqJS.TerminalId = GetParamStr(req, 0)
+	reqJS.Reference = GetParamStr(req, 1)
+	strAmount := GetParamStr(req, 2)
+	reqJS.Narrative = GetParamStr(req, 3)
+	txData := GetParamStr(req, 4)
+	reqJS.ReferenceID = GetParamStr(req, 5)
+	reqJS.ReferenceDate = GetParamStr(req, 6)
+	reqJS.TxID = GetParamStr(req, 7)
+	reqJS.TxDate = GetParamStr(req, 8)
+	reqJS.Checksum = GetParamStr(req, 9)
+
 	// decode KLV data
 	reqJS.TxData, err = DecodeKLV(txData)
 	if err != nil {
-		return nil, "", RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 
-	// generate checksumdata
-	checksumData := reqJS.MethodName + reqJS.TerminalId + reqJS.Reference +
-					strAmount + reqJS.Narrative + reqJS.TxType +
-					txData + reqJS.TxID + reqJS.TxDate
+	// parse amount in minor units of the transaction currency
+	err = reqJS.Parse(strAmount, (*reqJS.TxData)[KLV_TX_CURRENCY_CODE])
+	if err != nil {
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
 
-	
-	return reqJS, checksumData, nil
+	return reqJS, nil
 }
 
 
-func MapReqWithRefToJSON(req *Req) (*ReqWithRefJSON, string, error) {
+// Function MapStopReqToJSON maps a stop card request
+func MapStopReqToJSON(req *Req) (*StopReqJSON, error) {
 	var err error
 
 	// map values
-	reqJS := new(ReqWithRefJSON)
+	reqJS := new(StopReqJSON)
+	reqJS.MethodName = req.MethodName
+	reqJS.TerminalId = GetParamStr(req, 0)
+	reqJS.Reference = GetParamStr(req, 1)
+	reqJS.VoucherNumber = GetParamStr(req, 2)
+	reqJS.StopReason = GetParamStr(req, 3)
+	txData := GetParamStr(req, 4)
+	reqJS.TxID = GetParamStr(req, 5)
+	reqJS.TxDate = GetParamStr(req, 6)
+	reqJS.Checksum = GetParamStr(req, 7)
+
+	// decode KLV data
+	reqJS.TxData, err = DecodeKLV(txData)
+	if err != nil {
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	return reqJS, nil
+}
+
+
+// Function MapBalanceReqToJSON maps a balance request
+func MapBalanceReqToJSON(req *Req) (*BalanceReqJSON, error) {
+	var err error
+
+	// map values
+	reqJS := new(BalanceReqJSON)
 	reqJS.MethodName = req.MethodName
-	reqJS.TerminalId = req.TagParams.TagParam[0].TagValue.Value
-	reqJS.Reference = req.TagParams.TagParam[1].TagValue.Value
-	strAmount := req.TagParams.TagParam[2].TagValue.Value
-	reqJS.Narrative = req.TagParams.TagParam[3].TagValue.Value
-	txData := req.TagParams.TagParam[4].TagValue.Value
-	reqJS.ReferenceID = req.TagParams.TagParam[5].TagValue.Value
-	reqJS.ReferenceDate = req.TagParams.TagParam[6].TagValue.Value
-	reqJS.TxID = req.TagParams.TagParam[7].TagValue.Value
-	reqJS.TxDate = req.TagParams.TagParam[8].TagValue.Value
-	reqJS.Checksum = req.TagParams.TagParam[9].TagValue.Value
-
-	// convert amount to float
-	reqJS.RequestAmount, err = AmountToFloat(strAmount)
+	reqJS.TerminalId = GetParamStr(req, 0)
+	reqJS.Reference = GetParamStr(req, 1)
+	txData := GetParamStr(req, 2)
+	reqJS.TxID = GetParamStr(req, 3)
+	reqJS.TxDate = GetParamStr(req, 4)
+	reqJS.Checksum = GetParamStr(req, 5)
+
+	// decode KLV data
+	reqJS.TxData, err = DecodeKLV(txData)
 	if err != nil {
-		return nil, "", RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 
+	return reqJS, nil
+}
+
+
+// Function MapPINReqToJSON maps a validate PIN request
+func MapPINReqToJSON(req *Req) (*PINReqJSON, error) {
+	var err error
+
+	// map values
+	reqJS := new(PINReqJSON)
+	reqJS.MethodName = req.MethodName
+	reqJS.TerminalId = GetParamStr(req, 0)
+	reqJS.Reference = GetParamStr(req, 1)
+	reqJS.CardNumber = GetParamStr(req, 2)
+	reqJS.PINBlock = GetParamStr(req, 3)
+	txData := GetParamStr(req, 4)
+	reqJS.TxID = GetParamStr(req, 5)
+	reqJS.TxDate = GetParamStr(req, 6)
+	reqJS.Checksum = GetParamStr(req, 7)
+	reqJS.Last4 = reqJS.CardNumber[len(reqJS.CardNumber)-4:]
+
 	// decode KLV data
 	reqJS.TxData, err = DecodeKLV(txData)
 	if err != nil {
-		return nil, "", RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 
-	// generate checksumdata
-	checksumData:= reqJS.MethodName + reqJS.TerminalId + reqJS.Reference + 
-				strAmount + reqJS.Narrative + txData + reqJS.ReferenceID +
-				reqJS.ReferenceDate + reqJS.TxID + reqJS.TxDate
-	
-	return reqJS, checksumData, nil
+	return reqJS, nil
 }
 
-func MapStopReqToJSON(req *Req) (*StopReqJSON, string, error) {
+
+// Function MapAdminMsgReqToJSON maps an administrative message request
+func MapAdminMsgReqToJSON(req *Req) (*AdminMsgReqJSON, error) {
 	var err error
 
 	// map values
-	reqJS := new(StopReqJSON)
+	reqJS := new(AdminMsgReqJSON)
 	reqJS.MethodName = req.MethodName
-	reqJS.TerminalId = req.TagParams.TagParam[0].TagValue.Value
-	reqJS.Reference = req.TagParams.TagParam[1].TagValue.Value
-	reqJS.VoucherNumber = req.TagParams.TagParam[2].TagValue.Value
-	reqJS.StopReason = req.TagParams.TagParam[3].TagValue.Value
-	txData := req.TagParams.TagParam[4].TagValue.Value
-	reqJS.TxID = req.TagParams.TagParam[5].TagValue.Value
-	reqJS.TxDate = req.TagParams.TagParam[6].TagValue.Value
-	reqJS.Checksum = req.TagParams.TagParam[7].TagValue.Value
+	reqJS.TerminalId = GetParamStr(req, 0)
+	reqJS.Reference = GetParamStr(req, 1)
+	reqJS.MessageType = GetParamStr(req, 2)
+	reqJS.Message = GetParamStr(req, 3)
+	txData := GetParamStr(req, 4)
+	reqJS.TxID = GetParamStr(req, 5)
+	reqJS.TxDate = GetParamStr(req, 6)
+	reqJS.Checksum = GetParamStr(req, 7)
 
 	// decode KLV data
 	reqJS.TxData, err = DecodeKLV(txData)
 	if err != nil {
-		return nil, "", RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 
-	// generate checksumdata
-	checksumData:= reqJS.MethodName + reqJS.TerminalId + reqJS.Reference +
-				reqJS.VoucherNumber + reqJS.StopReason + txData +
-				reqJS.TxID + reqJS.TxDate
-	
-	return reqJS, checksumData, nil
+	return reqJS, nil
 }
 
 
@@ -372,26 +463,13 @@ func MapToJSON(object interface{}) ([]byte, error) {
 	return jsonStr, nil
 }
 
-func AmountToFloat(amount string) (float64, error){
-	// convert amount to float
-	fAmount, err := strconv.ParseFloat(amount[0:(len(amount)-2)]+"."+
-					amount[(len(amount)-2):], 64)
-	if err != nil {
-		return 0, fmt.Errorf(helpers.GetFunctionName() + "- %s", err.Error())
+// Clear (or maybe encrypt) sensitive values comming from requests,
+// the verified terminal is kept as the request program
+func ProtectReqValues(reqJS Request) {
+	// keep program
+	if reqJS.Header().TerminalId != "" {
+		reqJS.Header().ProgramId = reqJS.Header().TerminalId
 	}
-
-	return fAmount, nil
-}
-
-
-// Clear (or maybe encrypt) sensitive values comming from requests
-func ProtectReqValues(reqJS *ReqJSON) error {
 	// clear terminal and checksum values
-	reqJS.TerminalId, reqJS.Checksum = "", ""
-	return nil
+	reqJS.Header().TerminalId, reqJS.Header().Checksum = "", ""
 }
-func ProtectReqWithRefValues(reqJS *ReqWithRefJSON) error {
-	// clear terminal and checksum values
-	reqJS.TerminalId, reqJS.Checksum = "", ""
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,106 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	lifecycle "github.com/kueski-dev/paymentology-paymethods/models/lifecycle"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+)
+
+// Authorization lifecycle allowed transitions by state, the
+// state of an authorization is the transaction type of the last
+// message applied to it. Repeated reversals are partial reversals,
+// a LoadAdjustment after a partial LoadAuthReversal credits the load.
+var TX_TRANSITIONS = map[string][]string{
+	TX_TYPE_LOAD_AUTH: 			{TX_TYPE_LOAD_ADJUSTMENT, TX_TYPE_LOAD_AUTH_REVERSAL},
+	TX_TYPE_LOAD_AUTH_REVERSAL: {TX_TYPE_LOAD_ADJUSTMENT, TX_TYPE_LOAD_AUTH_REVERSAL},
+	TX_TYPE_LOAD_ADJUSTMENT: 	{TX_TYPE_LOAD_REVERSAL},
+	TX_TYPE_LOAD_REVERSAL: 		{TX_TYPE_LOAD_REVERSAL},
+	TX_TYPE_DEDUCT: 			{TX_TYPE_DEDUCT_REVERSAL, TX_TYPE_DEDUCT_ADJUSTMENT},
+	TX_TYPE_DEDUCT_ADJUSTMENT: 	{TX_TYPE_DEDUCT_REVERSAL},
+	TX_TYPE_DEDUCT_REVERSAL: 	{TX_TYPE_DEDUCT_REVERSAL},
+}
+
+
+// Function IsValidTransition checks if a lifecycle transition is allowed
+func IsValidTransition(fromState string, toState string) bool {
+	for _, state := range TX_TRANSITIONS[fromState] {
+		if state == toState {
+			return true
+		}
+	}
+	return false
+}
+
+
+// Function StartAuthorization starts the lifecycle of an approved
+// Deduct or LoadAuth, errors are logged
+func StartAuthorization(reqJS Request, txType string) {
+	err := lifecycle.Start(reqJS.Header().Reference, reqJS.Header().TxID, txType)
+	if err != nil {
+		logger.LogError(err.Error())
+	}
+}
+
+
+// Function TransitionAuthorization makes the lifecycle transition of
+// a message on the authorization of its reference id, returns false
+// when the transition is not allowed. The authorization is started in
+// the original transaction type when it was not found. Messages that
+// change the balances use AuthorizationCheck instead.
+func TransitionAuthorization(reqJS *ReqWithRefJSON, originalType string, txType string) (bool, error) {
+
+	// make transition
+	trn, err := lifecycle.MakeTransition(reqJS.Reference, reqJS.ReferenceID, reqJS.TxID, txType,
+		originalType, IsValidTransition)
+	if err != nil {
+		return false, RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// log invalid transitions
+	logTransition(trn)
+
+	return trn.Valid, nil
+}
+
+
+// Function AuthorizationCheck gets the lifecycle check of a reversal or
+// adjustment, the transition is made in the database transaction of the
+// balance update. Invalid transitions reject the message, or flag it for
+// review when the message is always booked.
+func AuthorizationCheck(reqJS *ReqWithRefJSON, originalType string, txType string, booked bool) wallet.LinkCheck {
+	return func(ctx context.Context, tx pgx.Tx, result *wallet.LinkResult) error {
+
+		// make transition
+		trn, err := lifecycle.MakeTransitionTx(ctx, tx, reqJS.Reference, reqJS.ReferenceID, reqJS.TxID, txType,
+			originalType, IsValidTransition)
+		if err != nil {
+			return err
+		}
+
+		// log invalid transitions
+		logTransition(trn)
+		if !trn.Valid {
+			result.Rejected = !booked
+			result.Review = result.Review || booked
+		}
+
+		return nil
+	}
+}
+
+
+// Logs an invalid lifecycle transition
+func logTransition(trn *lifecycle.Transition) {
+	if !trn.Valid {
+		logger.LogWarning(fmt.Sprintf("%s - invalid transition %s -> %s authorization tx-id=%s tx-id=%s",
+			helpers.GetFunctionName(), trn.FromState, trn.ToState, trn.AuthorizationTxID, trn.TxID))
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import "testing"
+
+
+// Every message of a sequence makes a valid transition
+// from the state of the message before it
+func TestTransitionSequences(t *testing.T) {
+	tests := []struct {
+		name 		string
+		sequence 	[]string
+		valid 		bool
+	}{
+		{"load settled", []string{TX_TYPE_LOAD_AUTH, TX_TYPE_LOAD_ADJUSTMENT, TX_TYPE_LOAD_REVERSAL}, true},
+		{"load partially reversed then adjusted", []string{TX_TYPE_LOAD_AUTH, TX_TYPE_LOAD_AUTH_REVERSAL,
+			TX_TYPE_LOAD_AUTH_REVERSAL, TX_TYPE_LOAD_ADJUSTMENT}, true},
+		{"load adjusted then auth reversed", []string{TX_TYPE_LOAD_AUTH, TX_TYPE_LOAD_ADJUSTMENT,
+			TX_TYPE_LOAD_AUTH_REVERSAL}, false},
+		{"deduct adjusted then reversed", []string{TX_TYPE_DEDUCT, TX_TYPE_DEDUCT_ADJUSTMENT,
+			TX_TYPE_DEDUCT_REVERSAL, TX_TYPE_DEDUCT_REVERSAL}, true},
+		{"deduct reversed then adjusted", []string{TX_TYPE_DEDUCT, TX_TYPE_DEDUCT_REVERSAL,
+			TX_TYPE_DEDUCT_ADJUSTMENT}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := true
+			for i := 1; i < len(tt.sequence); i++ {
+				valid = valid && IsValidTransition(tt.sequence[i-1], tt.sequence[i])
+			}
+			if valid != tt.valid {
+				t.Errorf("sequence=%v valid=%t, %t expected", tt.sequence, valid, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+)
+
+// XML-RPC value types
+const (
+	XMLRPC_TYPE_STRING = "string"
+	XMLRPC_TYPE_INT = "int"
+	XMLRPC_TYPE_I4 = "i4"
+	XMLRPC_TYPE_I8 = "i8"
+	XMLRPC_TYPE_DOUBLE = "double"
+	XMLRPC_TYPE_BOOLEAN = "boolean"
+	XMLRPC_TYPE_DATETIME = "dateTime.iso8601"
+	XMLRPC_TYPE_BASE64 = "base64"
+	XMLRPC_TYPE_STRUCT = "struct"
+	XMLRPC_TYPE_ARRAY = "array"
+	XMLRPC_TYPE_NIL = "nil"
+)
+
+// accepted dateTime.iso8601 layouts
+var xmlrpcDateTimeLayouts = []string{
+	XMLRPC_DATETIME_FORMAT,
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"20060102T15:04:05Z07:00",
+}
+
+
+// XML-RPC request value struct. Value keeps the text as it was
+// received (used by the checksum), Type the XML-RPC type name and
+// Data the decoded Go value: string, int64, float64, bool,
+// time.Time, []byte, []interface{}, map[string]interface{} or nil
+type Value struct {
+	Value 	string
+	Type  	string
+	Data  	interface{}
+}
+
+
+// Function UnmarshalXML decodes a <value> element
+func (v *Value) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var text strings.Builder
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tk := token.(type) {
+			case xml.CharData:
+				text.Write(tk)
+			case xml.StartElement:
+				// typed value
+				err = v.decodeTyped(d, tk)
+				if err != nil {
+					return err
+				}
+				// skip until the value end element
+				return d.Skip()
+			case xml.EndElement:
+				// untyped values are strings
+				v.Value, v.Type, v.Data = text.String(), XMLRPC_TYPE_STRING, text.String()
+				return nil
+		}
+	}
+}
+
+
+// Decodes the typed element inside a <value> element
+func (v *Value) decodeTyped(d *xml.Decoder, start xml.StartElement) error {
+	var err error
+
+	v.Type = start.Name.Local
+
+	// compound types
+	switch v.Type {
+		case XMLRPC_TYPE_STRUCT:
+			v.Data, err = decodeStruct(d)
+			return err
+		case XMLRPC_TYPE_ARRAY:
+			v.Data, err = decodeArray(d)
+			return err
+		case XMLRPC_TYPE_NIL:
+			v.Data = nil
+			return d.Skip()
+	}
+
+	// scalar types
+	var text string
+	err = d.DecodeElement(&text, &start)
+	if err != nil {
+		return err
+	}
+	v.Value = text
+
+	switch v.Type {
+		case XMLRPC_TYPE_STRING:
+			v.Data = text
+		case XMLRPC_TYPE_INT, XMLRPC_TYPE_I4, XMLRPC_TYPE_I8:
+			v.Data, err = strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		case XMLRPC_TYPE_DOUBLE:
+			v.Data, err = strconv.ParseFloat(strings.TrimSpace(text), 64)
+		case XMLRPC_TYPE_BOOLEAN:
+			v.Data, err = strconv.ParseBool(strings.TrimSpace(text))
+		case XMLRPC_TYPE_DATETIME:
+			v.Data, err = ParseDateTime(text)
+		case XMLRPC_TYPE_BASE64:
+			v.Data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		default:
+			err = fmt.Errorf("unknown xml-rpc type %s", v.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s value: %s", v.Type, err.Error())
+	}
+
+	return nil
+}
+
+
+// Decodes the members of a <struct> element
+func decodeStruct(d *xml.Decoder) (map[string]interface{}, error) {
+	members := make(map[string]interface{})
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tk := token.(type) {
+			case xml.StartElement:
+				if tk.Name.Local != "member" {
+					return nil, fmt.Errorf("unexpected element %s in struct", tk.Name.Local)
+				}
+				var member struct {
+					Name  string 	`xml:"name"`
+					Value Value 	`xml:"value"`
+				}
+				err = d.DecodeElement(&member, &tk)
+				if err != nil {
+					return nil, err
+				}
+				members[member.Name] = member.Value.Data
+			case xml.EndElement:
+				return members, nil
+		}
+	}
+}
+
+
+// Decodes the values of an <array> element
+func decodeArray(d *xml.Decoder) ([]interface{}, error) {
+	var data struct {
+		Values []Value 	`xml:"data>value"`
+	}
+
+	err := d.DecodeElement(&data, &xml.StartElement{Name: xml.Name{Local: XMLRPC_TYPE_ARRAY}})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(data.Values))
+	for i := range data.Values {
+		values[i] = data.Values[i].Data
+	}
+
+	return values, nil
+}
+
+
+// Function ParseDateTime parses a XML-RPC dateTime.iso8601 value
+func ParseDateTime(value string) (time.Time, error) {
+	var err error
+	var dt time.Time
+
+	for _, layout := range xmlrpcDateTimeLayouts {
+		dt, err = time.Parse(layout, strings.TrimSpace(value))
+		if err == nil {
+			return dt, nil
+		}
+	}
+
+	return dt, err
+}
+
+
+// Function GetParamValues gets the decoded values of the request params
+func GetParamValues(req *Req) []interface{} {
+	values := make([]interface{}, len(req.TagParams.TagParam))
+	for i := range req.TagParams.TagParam {
+		values[i] = req.TagParams.TagParam[i].TagValue.Data
+	}
+	return values
+}
+
+
+// Function ParseTxDate parses a Paymentology transaction date,
+// dates without time zone are in the configured location
+func ParseTxDate(value string) (time.Time, error) {
+	var err error
+	var dt time.Time
+
+	for _, layout := range xmlrpcDateTimeLayouts {
+		dt, err = time.ParseInLocation(layout, strings.TrimSpace(value), configs.TxDateLocation)
+		if err == nil {
+			return dt, nil
+		}
+	}
+
+	return dt, err
+}
+
+
+// Function IsTxDateInWindow checks if a transaction date is
+// within the configured max skew of a time
+func IsTxDateInWindow(txTime time.Time, at time.Time) bool {
+	skew := at.Sub(txTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	return skew <= configs.TxDateMaxSkew
+}
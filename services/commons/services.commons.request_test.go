@@ -0,0 +1,96 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+	"time"
+)
+
+
+func TestValueUnmarshalXML(t *testing.T) {
+	tests := []struct {
+		name 		string
+		xml 		string
+		valueType 	string
+		data 		interface{}
+	}{
+		{"untyped string", "<value>card holder</value>", XMLRPC_TYPE_STRING, "card holder"},
+		{"string", "<value><string>  padded </string></value>", XMLRPC_TYPE_STRING, "  padded "},
+		{"int", "<value><int>-25</int></value>", XMLRPC_TYPE_INT, int64(-25)},
+		{"i4", "<value><i4> 1500 </i4></value>", XMLRPC_TYPE_I4, int64(1500)},
+		{"double", "<value><double>17.0512</double></value>", XMLRPC_TYPE_DOUBLE, 17.0512},
+		{"boolean", "<value><boolean>1</boolean></value>", XMLRPC_TYPE_BOOLEAN, true},
+		{"dateTime.iso8601", "<value><dateTime.iso8601>20220601T13:05:09</dateTime.iso8601></value>", XMLRPC_TYPE_DATETIME,
+			time.Date(2022, 6, 1, 13, 5, 9, 0, time.UTC)},
+		{"dateTime.iso8601 with zone", "<value><dateTime.iso8601>2022-06-01T13:05:09-05:00</dateTime.iso8601></value>",
+			XMLRPC_TYPE_DATETIME, time.Date(2022, 6, 1, 18, 5, 9, 0, time.UTC)},
+		{"base64", "<value><base64>S3Vlc2tp</base64></value>", XMLRPC_TYPE_BASE64, []byte("Kueski")},
+		{"nil", "<value><nil/></value>", XMLRPC_TYPE_NIL, nil},
+		{"array", "<value><array><data><value><int>1</int></value><value>two</value><value><boolean>0</boolean></value></data></array></value>",
+			XMLRPC_TYPE_ARRAY, []interface{}{int64(1), "two", false}},
+		{"empty array", "<value><array><data></data></array></value>", XMLRPC_TYPE_ARRAY, []interface{}{}},
+		{"struct", "<value><struct><member><name>resultCode</name><value><int>1</int></value></member>" +
+			"<member><name>narrative</name><value><string>ATM</string></value></member></struct></value>",
+			XMLRPC_TYPE_STRUCT, map[string]interface{}{"resultCode": int64(1), "narrative": "ATM"}},
+		{"nested struct and array", "<value><struct><member><name>klv</name><value><array><data>" +
+			"<value><struct><member><name>key</name><value>TerminalType</value></member></struct></value>" +
+			"</data></array></value></member></struct></value>",
+			XMLRPC_TYPE_STRUCT, map[string]interface{}{"klv": []interface{}{map[string]interface{}{"key": "TerminalType"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Value
+			err := xml.Unmarshal([]byte(tt.xml), &v)
+			if err != nil {
+				t.Fatalf("Unmarshal error=%s", err.Error())
+			}
+			if v.Type != tt.valueType {
+				t.Errorf("type=%s, %s expected", v.Type, tt.valueType)
+			}
+			if dt, ok := tt.data.(time.Time); ok {
+				if got, ok := v.Data.(time.Time); !ok || !got.Equal(dt) {
+					t.Errorf("data=%#v, %s expected", v.Data, dt)
+				}
+				return
+			}
+			if !reflect.DeepEqual(v.Data, tt.data) {
+				t.Errorf("data=%#v, %#v expected", v.Data, tt.data)
+			}
+		})
+	}
+}
+
+
+func TestValueUnmarshalXMLMalformed(t *testing.T) {
+	tests := []struct {
+		name 	string
+		xml 	string
+	}{
+		{"int not a number", "<value><int>12a</int></value>"},
+		{"int overflow", "<value><i8>9223372036854775808</i8></value>"},
+		{"double not a number", "<value><double>1,5</double></value>"},
+		{"boolean not a boolean", "<value><boolean>maybe</boolean></value>"},
+		{"dateTime not a date", "<value><dateTime.iso8601>yesterday</dateTime.iso8601></value>"},
+		{"base64 not encoded", "<value><base64>%%%</base64></value>"},
+		{"unknown type", "<value><decimal>1.5</decimal></value>"},
+		{"struct without member", "<value><struct><name>resultCode</name></struct></value>"},
+		{"struct with malformed member", "<value><struct><member><name>amount</name><value><int>x</int></value></member></struct></value>"},
+		{"array with malformed value", "<value><array><data><value><boolean>2</boolean></value></data></array></value>"},
+		{"unterminated value", "<value><int>1</int>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Value
+			err := xml.Unmarshal([]byte(tt.xml), &v)
+			if err == nil {
+				t.Errorf("Unmarshal type=%s data=%#v, error expected", v.Type, v.Data)
+			}
+		})
+	}
+}
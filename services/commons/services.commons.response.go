@@ -0,0 +1,131 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+)
+
+// XML-RPC value constants
+const (
+	XMLRPC_DATETIME_FORMAT = "20060102T15:04:05"
+	XMLRPC_BOOLEAN_TRUE = "1"
+	XMLRPC_BOOLEAN_FALSE = "0"
+	XMLRPC_FAULT_PARSE_ERROR = -32700
+)
+
+// XML-RPC method response struct, only one of
+// Params or Fault is set
+type Resp struct {
+	XMLName   xml.Name               	`xml:"methodResponse"`
+	Params    *RespParams 				`xml:"params,omitempty"`
+	Fault     *RespFault 				`xml:"fault,omitempty"`
+}
+type RespParams struct {
+	Members []RespMember 				`xml:"param>value>struct>member"`
+}
+type RespFault struct {
+	Members []RespMember 				`xml:"value>struct>member"`
+}
+type RespMember struct {
+	Name  string 						`xml:"name"`
+	Value RespValue 					`xml:"value"`
+}
+type RespValue struct {
+	Int      *string 					`xml:"int,omitempty"`
+	String   *string 					`xml:"string,omitempty"`
+	Double   *string 					`xml:"double,omitempty"`
+	Boolean  *string 					`xml:"boolean,omitempty"`
+	DateTime *string 					`xml:"dateTime.iso8601,omitempty"`
+}
+
+
+// Function NewResp creates an empty response struct
+func NewResp() *Resp {
+	return &Resp{Params: new(RespParams)}
+}
+
+
+// Adds an int member to the response
+func (resp *Resp) AddInt(name string, value int64) *Resp {
+	str := strconv.FormatInt(value, 10)
+	return resp.addMember(name, RespValue{Int: &str})
+}
+
+// Adds a string member to the response
+func (resp *Resp) AddString(name string, value string) *Resp {
+	return resp.addMember(name, RespValue{String: &value})
+}
+
+// Adds a double member to the response
+func (resp *Resp) AddDouble(name string, value float64) *Resp {
+	str := strconv.FormatFloat(value, 'f', -1, 64)
+	return resp.addMember(name, RespValue{Double: &str})
+}
+
+// Adds a boolean member to the response
+func (resp *Resp) AddBoolean(name string, value bool) *Resp {
+	str := XMLRPC_BOOLEAN_FALSE
+	if value {
+		str = XMLRPC_BOOLEAN_TRUE
+	}
+	return resp.addMember(name, RespValue{Boolean: &str})
+}
+
+// Adds a dateTime.iso8601 member to the response
+func (resp *Resp) AddDateTime(name string, value time.Time) *Resp {
+	str := value.Format(XMLRPC_DATETIME_FORMAT)
+	return resp.addMember(name, RespValue{DateTime: &str})
+}
+
+// Adds a member to the response params
+func (resp *Resp) addMember(name string, value RespValue) *Resp {
+	if resp.Params == nil {
+		resp.Params = new(RespParams)
+	}
+	resp.Params.Members = append(resp.Params.Members, RespMember{Name: name, Value: value})
+	return resp
+}
+
+
+// Function BuildFaultResp creates a XML-RPC fault response
+func BuildFaultResp(faultCode int64, faultString string) *Resp {
+	code := strconv.FormatInt(faultCode, 10)
+
+	return &Resp{
+		Fault: &RespFault{
+			Members: []RespMember{
+				{Name: "faultCode", Value: RespValue{Int: &code}},
+				{Name: "faultString", Value: RespValue{String: &faultString}},
+			},
+		},
+	}
+}
+
+
+// Function BuildSingleIntResp create a single int response
+func BuildSingleIntResp(resultCode string) *Resp {
+	return NewResp().addMember("resultCode", RespValue{Int: &resultCode})
+}
+
+
+// Function BuildBalanceResp create a balance response
+// with the result code and the balance amount in minor units
+func BuildBalanceResp(resultCode string, balanceAmount int64) *Resp {
+	return BuildSingleIntResp(resultCode).AddInt("balanceAmount", balanceAmount)
+}
+
+
+// Function MarshalResp converts a response to its XML string,
+// returns an empty string if the response cannot be converted
+func MarshalResp(resp *Resp) string {
+	xmlResp, err := xml.Marshal(resp)
+	if err != nil {
+		return ""
+	}
+	return string(xmlResp)
+}
@@ -0,0 +1,53 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// Response bodies sent before the response builder, the balance
+// amount was sent as 000 and is now sent as 0, the same int value
+const (
+	GOLDEN_DO_NOT_HONOR = "<methodResponse><params><param><value><struct><member><name>resultCode</name><value><int>-9</int></value></member></struct></value></param></params></methodResponse>"
+	GOLDEN_ZERO_BALANCE = "<methodResponse><params><param><value><struct><member><name>resultCode</name><value><int>1</int></value></member><member><name>balanceAmount</name><value><int>0</int></value></member></struct></value></param></params></methodResponse>"
+	GOLDEN_INCORRECT_PIN = "<methodResponse><params><param><value><struct><member><name>resultCode</name><value><int>-25</int></value></member></struct></value></param></params></methodResponse>"
+)
+
+
+func TestMarshalResp(t *testing.T) {
+	tests := []struct {
+		name 		string
+		resp 		*Resp
+		expected 	string
+	}{
+		{"do not honor", BuildSingleIntResp(RESP_CODE_DO_NOT_HONOR), GOLDEN_DO_NOT_HONOR},
+		{"zero balance", BuildBalanceResp(RESP_CODE_APPROVED, 0), GOLDEN_ZERO_BALANCE},
+		{"incorrect pin", BuildSingleIntResp(RESP_CODE_INCORRECT_PIN), GOLDEN_INCORRECT_PIN},
+		{"int", NewResp().AddInt("balanceAmount", -12345),
+			"<methodResponse><params><param><value><struct><member><name>balanceAmount</name><value><int>-12345</int></value></member></struct></value></param></params></methodResponse>"},
+		{"string", NewResp().AddString("message", "a < b & c"),
+			"<methodResponse><params><param><value><struct><member><name>message</name><value><string>a &lt; b &amp; c</string></value></member></struct></value></param></params></methodResponse>"},
+		{"double", NewResp().AddDouble("rate", 17.0512),
+			"<methodResponse><params><param><value><struct><member><name>rate</name><value><double>17.0512</double></value></member></struct></value></param></params></methodResponse>"},
+		{"boolean", NewResp().AddBoolean("enabled", true).AddBoolean("blocked", false),
+			"<methodResponse><params><param><value><struct><member><name>enabled</name><value><boolean>1</boolean></value></member><member><name>blocked</name><value><boolean>0</boolean></value></member></struct></value></param></params></methodResponse>"},
+		{"dateTime.iso8601", NewResp().AddDateTime("txDate", time.Date(2022, 6, 1, 13, 5, 9, 0, time.UTC)),
+			"<methodResponse><params><param><value><struct><member><name>txDate</name><value><dateTime.iso8601>20220601T13:05:09</dateTime.iso8601></value></member></struct></value></param></params></methodResponse>"},
+		{"multiple members", BuildSingleIntResp(RESP_CODE_APPROVED).AddString("cardId", "card-1").AddDouble("amount", 10.5),
+			"<methodResponse><params><param><value><struct><member><name>resultCode</name><value><int>1</int></value></member><member><name>cardId</name><value><string>card-1</string></value></member><member><name>amount</name><value><double>10.5</double></value></member></struct></value></param></params></methodResponse>"},
+		{"fault", BuildFaultResp(XMLRPC_FAULT_PARSE_ERROR, "parse error, not well formed"),
+			"<methodResponse><fault><value><struct><member><name>faultCode</name><value><int>-32700</int></value></member><member><name>faultString</name><value><string>parse error, not well formed</string></value></member></struct></value></fault></methodResponse>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := MarshalResp(tt.resp)
+			if body != tt.expected {
+				t.Errorf("MarshalResp=%s, %s expected", body, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package have shared functions and data types.
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+)
+
+// Parameter schema struct. Required parameters must be
+// present and not empty, optional parameters may be missing
+// at the end of the request or sent empty
+type ParamSchema struct {
+	Name 		string
+	Types 		[]string
+	Required 	bool
+	MinLength 	int
+}
+
+// Schema validation error struct
+type SchemaError struct {
+	MethodName 	string 		`json:"method-name"`
+	Param 		string 		`json:"param"`
+	Position 	int 		`json:"position"`
+	Reason 		string 		`json:"reason"`
+}
+
+// Function Error implements the error interface
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("schema validation fail method=%s param=%s position=%d reason=%s",
+		e.MethodName, e.Param, e.Position, e.Reason)
+}
+
+
+// parameter type sets
+var (
+	paramText = []string{XMLRPC_TYPE_STRING}
+	paramNumber = []string{XMLRPC_TYPE_STRING, XMLRPC_TYPE_INT, XMLRPC_TYPE_I4, XMLRPC_TYPE_I8}
+	paramDate = []string{XMLRPC_TYPE_STRING, XMLRPC_TYPE_DATETIME}
+)
+
+// common parameters
+var (
+	paramTerminalID = ParamSchema{Name: "TerminalID", Types: paramText, Required: true}
+	paramReference = ParamSchema{Name: "Reference", Types: paramText, Required: true}
+	paramAmount = ParamSchema{Name: "Amount", Types: paramNumber, Required: true}
+	paramNarrative = ParamSchema{Name: "Narrative", Types: paramText, Required: false}
+	paramTxData = ParamSchema{Name: "TransactionData", Types: paramText, Required: false}
+	paramReferenceID = ParamSchema{Name: "ReferenceID", Types: paramText, Required: true}
+	paramReferenceDate = ParamSchema{Name: "ReferenceDate", Types: paramDate, Required: true}
+	paramTxID = ParamSchema{Name: "TransactionID", Types: paramText, Required: true}
+	paramTxDate = ParamSchema{Name: "TransactionDate", Types: paramDate, Required: true}
+	paramChecksum = ParamSchema{Name: "Checksum", Types: paramText, Required: true}
+)
+
+// Request parameters schemas
+var (
+	SCHEMA_REQ = []ParamSchema{paramTerminalID, paramReference, paramAmount, paramNarrative,
+		{Name: "TransactionType", Types: paramText, Required: true},
+		paramTxData, paramTxID, paramTxDate, paramChecksum}
+	SCHEMA_REQ_WITH_REF = []ParamSchema{paramTerminalID, paramReference, paramAmount, paramNarrative,
+		paramTxData, paramReferenceID, paramReferenceDate, paramTxID, paramTxDate, paramChecksum}
+	SCHEMA_STOP_REQ = []ParamSchema{paramTerminalID, paramReference,
+		{Name: "VoucherNumber", Types: paramText, Required: true, MinLength: 4},
+		{Name: "StopReason", Types: paramNumber, Required: true},
+		paramTxData, paramTxID, paramTxDate, paramChecksum}
+	SCHEMA_BALANCE_REQ = []ParamSchema{paramTerminalID, paramReference, paramTxData,
+		paramTxID, paramTxDate, paramChecksum}
+	SCHEMA_PIN_REQ = []ParamSchema{paramTerminalID, paramReference,
+		{Name: "CardNumber", Types: paramText, Required: true, MinLength: 4},
+		{Name: "PIN", Types: paramText, Required: true},
+		paramTxData, paramTxID, paramTxDate, paramChecksum}
+	SCHEMA_ADMIN_MSG_REQ = []ParamSchema{paramTerminalID, paramReference,
+		{Name: "MessageType", Types: paramText, Required: false},
+		{Name: "Message", Types: paramText, Required: false},
+		paramTxData, paramTxID, paramTxDate, paramChecksum}
+)
+
+// Checksum fields order, the checksum data is the method
+// name followed by the values of these params
+var (
+	CHECKSUM_REQ = []string{"TerminalID", "Reference", "Amount", "Narrative", "TransactionType",
+		"TransactionData", "TransactionID", "TransactionDate"}
+	CHECKSUM_REQ_WITH_REF = []string{"TerminalID", "Reference", "Amount", "Narrative", "TransactionData",
+		"ReferenceID", "ReferenceDate", "TransactionID", "TransactionDate"}
+	CHECKSUM_STOP_REQ = []string{"TerminalID", "Reference", "VoucherNumber", "StopReason",
+		"TransactionData", "TransactionID", "TransactionDate"}
+	CHECKSUM_BALANCE_REQ = []string{"TerminalID", "Reference", "TransactionData",
+		"TransactionID", "TransactionDate"}
+	CHECKSUM_PIN_REQ = []string{"TerminalID", "Reference", "CardNumber", "PIN",
+		"TransactionData", "TransactionID", "TransactionDate"}
+	CHECKSUM_ADMIN_MSG_REQ = []string{"TerminalID", "Reference", "MessageType", "Message",
+		"TransactionData", "TransactionID", "TransactionDate"}
+)
+
+
+// Function ValidateReq checks the request params against the
+// method schema, returns a *SchemaError if the request is not valid
+func ValidateReq(req *Req, schema []ParamSchema) error {
+
+	params := req.TagParams.TagParam
+	if len(params) > len(schema) {
+		return &SchemaError{MethodName: req.MethodName, Position: len(schema),
+			Reason: fmt.Sprintf("too many params, expected %d got %d", len(schema), len(params))}
+	}
+
+	// check each parameter
+	for i, ps := range schema {
+		// check missing params
+		if i >= len(params) {
+			if ps.Required {
+				return &SchemaError{MethodName: req.MethodName, Param: ps.Name, Position: i, Reason: "missing param"}
+			}
+			continue
+		}
+
+		// check param type
+		value := params[i].TagValue
+		if !isParamType(value.Type, ps.Types) {
+			return &SchemaError{MethodName: req.MethodName, Param: ps.Name, Position: i,
+				Reason: fmt.Sprintf("invalid type %s", value.Type)}
+		}
+
+		// check required values and length
+		if ps.Required && value.Value == "" {
+			return &SchemaError{MethodName: req.MethodName, Param: ps.Name, Position: i, Reason: "empty value"}
+		}
+		if len(value.Value) < ps.MinLength {
+			return &SchemaError{MethodName: req.MethodName, Param: ps.Name, Position: i,
+				Reason: fmt.Sprintf("value shorter than %d", ps.MinLength)}
+		}
+	}
+
+	return nil
+}
+
+
+// Function ValidateAndLogReq validates the request and writes
+// a structured log entry when the validation fails
+func ValidateAndLogReq(req *Req, schema []ParamSchema) error {
+	err := ValidateReq(req, schema)
+	if err != nil {
+		if schemaErr, ok := err.(*SchemaError); ok {
+			logEntry, jerr := json.Marshal(schemaErr)
+			if jerr == nil {
+				logger.LogWarning(string(logEntry))
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+
+// Function GetParamStr gets the received text of a param,
+// returns an empty string for missing optional params
+func GetParamStr(req *Req, position int) string {
+	if position < 0 || position >= len(req.TagParams.TagParam) {
+		return ""
+	}
+	return req.TagParams.TagParam[position].TagValue.Value
+}
+
+
+// Function GetParamPosition gets the position of a param
+// in the schema, returns -1 if the param does not exists
+func GetParamPosition(schema []ParamSchema, name string) int {
+	for i := range schema {
+		if schema[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+
+// Checks if a XML-RPC type is in the allowed types
+func isParamType(paramType string, types []string) bool {
+	for _, t := range types {
+		if t == paramType {
+			return true
+		}
+	}
+	return false
+}
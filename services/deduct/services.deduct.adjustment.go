@@ -19,77 +19,104 @@ package services
 
 import (
 	"fmt"
-	"github.com/gofiber/fiber/v2"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
 	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger" 
+	request "github.com/kueski-dev/paymentology-paymethods/models/request"
 	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
 	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 // Handles a Deduct Adjustment request
-func DeductAdjustment(c *fiber.Ctx) (*commons.RespSingleInt, error) {
+func DeductAdjustment(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
 	var err error
 
-	// Parse body
-	req := new(commons.Req)
-	err = c.BodyParser(req)
+	// get original deduct transaction
+	originalTX, err := wallet.GetOriginalTransaction(reqJS.Reference, reqJS.ReferenceID, commons.TX_TYPE_DEDUCT, wallet.TX_OPER_WITHDRAW)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	// check if original deduct transaction exists
+	if originalTX == nil {
+		// if original deduct tx not exists, it was never processed,
+		// adjustments must be booked even without original
+		logger.LogWarning(helpers.GetFunctionName() + "- deduct adjustment without original deduct transaction with tx-id=" + reqJS.ReferenceID)
+		return deductAdjustmentWithoutOriginal(reqJS, jsonReq)
+	}
 
-	// map request to JSON
-	reqJS, checksumData, err := commons.MapReqWithRefToJSON(req)
+	// adjust the original transaction, without funds the adjustment
+	// is booked and the wallet debt is recorded. Adjustments of an
+	// original already adjusted or reversed or with an invalid lifecycle
+	// transition are booked for review
+	check := commons.AuthorizationCheck(reqJS, originalTX.TypeId, commons.TX_TYPE_DEDUCT_ADJUSTMENT, true)
+	result, err := wallet.AdjustTransaction(originalTX, reqJS.TxID, reqJS.TxAmount(), wallet.BALANCE_WITHDRAW_AVAILABLE_DEBT, check, commons.TX_TYPE_DEDUCT_ADJUSTMENT,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 
-	// verify checksum
-	if commons.GetCheckSum(checksumData) != reqJS.Checksum {
-		logger.LogWarning(helpers.GetFunctionName() + 
-				fmt.Sprintf(" authentication fail method=%s tx-id=%s", reqJS.MethodName, reqJS.TxID))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
+	// duplicated adjustments are only logged
+	if result.Duplicated {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated deduct adjustment tx-id=%s original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.State))
+	} else if result.Review {
+		logger.LogWarning(fmt.Sprintf("%s - deduct adjustment tx-id=%s booked for review, original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.PreviousState))
 	}
+	logDebt(reqJS, result.DebtAmount)
 
-	// protect request values
-	err = commons.ProtectReqWithRefValues(reqJS)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
-	}
+	// return response
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
 
-	// get original deduct transaction
-	originalTX, err := wallet.GetTransaction(reqJS.Reference, reqJS.ReferenceID, true)
+
+// Books a deduct adjustment without original deduct once, without
+// original there is no link to detect a duplicated adjustment and the
+// request is reserved by terminal, method and tx-id as a Deduct
+func deductAdjustmentWithoutOriginal(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
+
+	// reserve request
+	reserved, resultCode, err := request.Reserve(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
-	// check if original deduct transaction exists
-	if originalTX == nil {
-		// if original deduct tx not exists, it was never processed
-		logger.LogWarning(helpers.GetFunctionName() + "- deduct adjustment without original deduct transaction with tx-id=" + reqJS.ReferenceID)
-		return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
+	if !reserved {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated deduct adjustment tx-id=%s stored result-code=%s", helpers.GetFunctionName(),
+						reqJS.TxID, resultCode))
+		if resultCode == "" {
+			// the first request is still in process
+			return commons.NewDecision(commons.RESP_CODE_TX_TIMEOUT), nil
+		}
+		return commons.NewDecision(resultCode), nil
 	}
 
-	// convert request to JSON
-	jsonReq, err := commons.MapToJSON(reqJS)
+	// withdraw the available balance, without funds the debt is recorded
+	debtAmount, err := wallet.WithdrawAvailableBalanceWithDebt(reqJS.Reference, reqJS.TxAmount(), commons.TX_TYPE_DEDUCT_ADJUSTMENT,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
+		// allow the request to be retried
+		errRel := request.Release(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID)
+		if errRel != nil {
+			logger.LogError(errRel.Error())
+		}
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	logDebt(reqJS, debtAmount)
 
-	// get wallet info
-	walletInfo, err:= wallet.GetInfo(reqJS.Reference)
+	// store result code
+	err = request.Complete(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID, commons.RESP_CODE_APPROVED)
 	if err != nil {
-		return nil, err
+		logger.LogError(err.Error())
 	}
 
-	// withdraw available balance
-	err = wallet.WithdrawAvailableBalance(reqJS.Reference, reqJS.RequestAmount, walletInfo.AvalilableBalance, 
-		commons.TX_TYPE_DEDUCT_ADJUSTMENT, 
-		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], 
-		reqJS.ReferenceID, reqJS.Narrative), string(jsonReq))
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
-	}
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
 
 
-	// return response
-	return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
+// Logs the debt recorded by a deduct adjustment
+func logDebt(reqJS *commons.ReqWithRefJSON, debtAmount money.Amount) {
+	if debtAmount > 0 {
+		logger.LogWarning(fmt.Sprintf("%s - deduct adjustment tx-id=%s walletid=%s recorded debt=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.Reference, debtAmount))
+	}
 }
\ No newline at end of file
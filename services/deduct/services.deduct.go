@@ -12,93 +12,167 @@ package services
 
 import (
 	"fmt"
-	"github.com/gofiber/fiber/v2"
+	"strings"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
 	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
 	card "github.com/kueski-dev/paymentology-paymethods/models/card" 
+	mcc "github.com/kueski-dev/paymentology-paymethods/models/mcc"
+	request "github.com/kueski-dev/paymentology-paymethods/models/request"
 	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
 	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 
-// Handles a Deduct Request
-func Deduct(c *fiber.Ctx) (*commons.RespSingleInt, error) {
-	var err error
+// MCC rules lookup
+var getMCCRules = mcc.GetWalletRules
+
+
+// Handles a Deduct Request, a retried request with the same terminal
+// and tx-id gets the stored result code and the balances are not changed again
+func Deduct(reqJS *commons.ReqJSON, jsonReq string) (*commons.Decision, error) {
 
-	// Parse body
-	req := new(commons.Req)
-	err = c.BodyParser(req)
+	// reserve request
+	reserved, resultCode, err := request.Reserve(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		logger.LogError(err.Error())
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+	if !reserved {
+		logger.LogWarning(fmt.Sprintf("%s - retried request tx-id=%s stored result-code=%s", helpers.GetFunctionName(),
+						reqJS.TxID, resultCode))
+		if resultCode == "" {
+			// the first request is still in process
+			return commons.NewDecision(commons.RESP_CODE_TX_TIMEOUT), nil
+		}
+		return commons.NewDecision(resultCode), nil
 	}
 
-	// map request to JSON
-	reqJS, checksumData, err := commons.MapReqToJSON(req)
+	// process request
+	decision, err := deduct(reqJS, jsonReq)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		// allow the request to be retried
+		errRel := request.Release(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID)
+		if errRel != nil {
+			logger.LogError(errRel.Error())
+		}
+		return nil, err
 	}
 
-	// verify checksum
-	if commons.GetCheckSum(checksumData) != reqJS.Checksum {
-		logger.LogWarning(helpers.GetFunctionName() + 
-				fmt.Sprintf(" authentication fail method=%s tx-id=%s", reqJS.MethodName, reqJS.TxID))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
-	}
-	
-	// protect request values
-	err = commons.ProtectReqValues(reqJS)
+	// store result code
+	err = request.Complete(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID, decision.ResultCode)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		logger.LogError(err.Error())
+	}
+
+	// apply the reversals received before the deduct
+	if decision.IsApproved() {
+		applyParkedReversals(reqJS.Reference, reqJS.TxID)
 	}
 
+	return decision, nil
+}
+
+
+// Processes a reserved Deduct Request
+func deduct(reqJS *commons.ReqJSON, jsonReq string) (*commons.Decision, error) {
+	var err error
+
 	// get card info
-	cardInfo, err:= card.GetInfo(reqJS.Reference, (*(*reqJS).TxData)["LastfourDigitsPAN"])
+	cardInfo, err:= card.GetInfo(reqJS.Reference, (*(*reqJS).TxData)[commons.KLV_LAST_FOUR_PAN])
 	if err != nil {
 		logger.LogError(err.Error())
-		return commons.BuildSingleIntResp(commons.RESP_CODE_DO_NOT_HONOR), nil
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
 	}
 
 	// check card is active or expired
 	if cardInfo == nil || !card.IsActive(cardInfo) {
 		logger.LogInfo(fmt.Sprintf("%s - card walletid=%s lastfour=%s is not active", helpers.GetFunctionName(),
-						reqJS.Reference, (*(*reqJS).TxData)["LastfourDigitsPAN"]))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_DO_NOT_HONOR), nil
+						reqJS.Reference, (*(*reqJS).TxData)[commons.KLV_LAST_FOUR_PAN]))
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
 	}
 
+	// keep the card and the ATM cash withdrawal flag in the
+	// transaction data, the ATM usage is counted with them
+	reqJS.ATM = commons.IsATM(reqJS.TxID, reqJS.TxData)
+	reqJS.CardId = cardInfo.CardId
+	jsonBytes, err := commons.MapToJSON(reqJS)
+	if err != nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	jsonReq = string(jsonBytes)
+
 	// get wallet info
 	walletInfo, err:= wallet.GetInfo(reqJS.Reference)
 	if err != nil {
 		logger.LogError(err.Error())
-		return commons.BuildSingleIntResp(commons.RESP_CODE_DO_NOT_HONOR), nil
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
 	}
 
 	// check wallet is active
 	if walletInfo == nil || !wallet.IsActive(walletInfo) {
 		logger.LogInfo(fmt.Sprintf("%s - walletid=%s is not active", helpers.GetFunctionName(), reqJS.Reference))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_DO_NOT_HONOR), nil
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
 	}
 
-	// convert request to JSON
-	jsonReq, err := commons.MapToJSON(reqJS)
+	// check merchant category rules
+	reason, err := checkMCC(reqJS, walletInfo)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		logger.LogError(err.Error())
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+	if reason != "" {
+		logger.LogInfo(fmt.Sprintf("%s - walletid=%s tx-id=%s declined, %s", helpers.GetFunctionName(),
+						reqJS.Reference, reqJS.TxID, reason))
+		wallet.PostTransaction(walletInfo.WalletId, reqJS.TxAmount(), commons.TX_TYPE_DEDUCT, commons.TX_OPER_INFO,
+					fmt.Sprintf("%s | %s | %s", commons.RESP_CODE[commons.RESP_CODE_DO_NOT_HONOR], reason, reqJS.Narrative), jsonReq)
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
 	}
 
 	// check for funds
 	if walletInfo.AvalilableBalance <= reqJS.RequestAmount {
-		wallet.PostTransaction(walletInfo.WalletId, reqJS.RequestAmount, commons.TX_TYPE_DEDUCT, commons.TX_OPER_INFO, 
-					fmt.Sprintf("%s | %s", commons.RESP_CODE[commons.RESP_CODE_NOT_SUFF_FUNDS] , reqJS.Narrative), string(jsonReq))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_NOT_SUFF_FUNDS), nil
+		wallet.PostTransaction(walletInfo.WalletId, reqJS.TxAmount(), commons.TX_TYPE_DEDUCT, commons.TX_OPER_INFO, 
+					fmt.Sprintf("%s | %s", commons.RESP_CODE[commons.RESP_CODE_NOT_SUFF_FUNDS] , reqJS.Narrative), jsonReq)
+		return commons.NewDecision(commons.RESP_CODE_NOT_SUFF_FUNDS), nil
 	}
 
-	// withdraw available balance
-	err = wallet.WithdrawAvailableBalance(reqJS.Reference, reqJS.RequestAmount, walletInfo.AvalilableBalance, 
+	// withdraw available balance within the spending limits
+	limitCheck := &wallet.LimitCheck{CardId: cardInfo.CardId, ATM: reqJS.ATM, TxTypes: commons.LIMIT_TX_TYPES}
+	exceeded, err := wallet.WithdrawAvailableBalance(reqJS.Reference, reqJS.TxAmount(), walletInfo.AvalilableBalance, limitCheck,
 					commons.TX_TYPE_DEDUCT, fmt.Sprintf("%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], 
-					reqJS.Narrative), string(jsonReq))
+					reqJS.Narrative), jsonReq)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	if exceeded != "" {
+		logger.LogInfo(fmt.Sprintf("%s - walletid=%s tx-id=%s amount=%s atm=%t exceeds the %s limit",
+			helpers.GetFunctionName(), reqJS.Reference, reqJS.TxID, reqJS.RequestAmount, reqJS.ATM, exceeded))
+		wallet.PostTransaction(walletInfo.WalletId, reqJS.TxAmount(), commons.TX_TYPE_DEDUCT, commons.TX_OPER_INFO,
+					fmt.Sprintf("%s | %s limit | %s", commons.RESP_CODE[commons.RESP_CODE_EXCEEDS_WITHDRAW], exceeded, reqJS.Narrative), jsonReq)
+		return commons.NewDecision(commons.RESP_CODE_EXCEEDS_WITHDRAW), nil
+	}
+
+	// start authorization lifecycle
+	commons.StartAuthorization(reqJS, commons.TX_TYPE_DEDUCT)
 
 	// return response
-	return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
-}
\ No newline at end of file
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
+
+
+// Checks the merchant category code against the rules of the request
+// program, the wallet group and the wallet, returns the decline reason
+func checkMCC(reqJS *commons.ReqJSON, walletInfo *wallet.WalletInfo) (string, error) {
+
+	// get rules
+	mccRules, err := getMCCRules(reqJS.ProgramId, walletInfo.GroupId, walletInfo.WalletId)
+	if err != nil {
+		return "", commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	var mccCode string
+	if reqJS.TxData != nil {
+		mccCode = strings.TrimSpace((*reqJS.TxData)[commons.KLV_MERCHANT_CATEGORY_CODE])
+	}
+
+	return mccRules.Declines(mccCode), nil
+}
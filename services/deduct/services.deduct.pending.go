@@ -0,0 +1,134 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Handles deduct transactions.
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	reversal "github.com/kueski-dev/paymentology-paymethods/models/reversal"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// Parked reversals method name
+const PARKED_REVERSAL_METHOD = "DeductReversal"
+
+
+// Applies the parked reversals of a recorded deduct transaction
+func applyParkedReversals(walletID string, txID string) {
+
+	// get parked reversals
+	parked, err := reversal.GetPending(PARKED_REVERSAL_METHOD, walletID, txID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return
+	}
+
+	for i := range parked {
+		_, err = applyParkedReversal(&parked[i])
+		if err != nil {
+			logger.LogError(err.Error())
+		}
+	}
+}
+
+
+// Function MatchParkedReversals applies the parked deduct reversals
+// whose original transaction was recorded
+func MatchParkedReversals() error {
+
+	// get parked reversals
+	parked, err := reversal.GetPending(PARKED_REVERSAL_METHOD, "", "")
+	if err != nil {
+		return commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	for i := range parked {
+		_, err = applyParkedReversal(&parked[i])
+		if err != nil {
+			logger.LogError(err.Error())
+		}
+	}
+
+	return nil
+}
+
+
+// Applies a parked reversal when its original deduct was booked,
+// the reversal of a declined deduct is expired. Returns false when
+// it is not applied
+func applyParkedReversal(parked *reversal.PendingReversal) (bool, error) {
+
+	// get original transaction
+	originalTX, err := wallet.GetOriginalTransaction(parked.WalletId, parked.ReferenceId,
+		commons.TX_TYPE_DEDUCT, wallet.TX_OPER_WITHDRAW)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	if originalTX == nil {
+		return false, expireDeclinedReversal(parked)
+	}
+
+	// get parked request
+	reqJS := new(commons.ReqWithRefJSON)
+	err = json.Unmarshal([]byte(parked.Data), reqJS)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// reverse original transaction, a reversal rejected by the
+	// authorization lifecycle is flagged for review
+	applied, err := reverseDeduct(reqJS, parked.Data, originalTX)
+	if err != nil {
+		return false, err
+	}
+	if !applied {
+		err = reversal.SetReview(parked.PendingId)
+		if err != nil {
+			return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		logger.LogWarning(fmt.Sprintf("%s - parked deduct reversal tx-id=%s rejected, original tx-id=%s flagged for review",
+			helpers.GetFunctionName(), parked.TxID, parked.ReferenceId))
+		return false, nil
+	}
+	err = reversal.SetApplied(parked.PendingId)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	logger.LogInfo(fmt.Sprintf("%s - parked deduct reversal tx-id=%s applied to original tx-id=%s",
+		helpers.GetFunctionName(), parked.TxID, parked.ReferenceId))
+
+	return true, nil
+}
+
+
+// Expires a parked reversal when its deduct was declined, the
+// declined deduct is only logged and there is nothing to reverse
+func expireDeclinedReversal(parked *reversal.PendingReversal) error {
+
+	// get declined deduct
+	declinedTX, err := wallet.GetOriginalTransaction(parked.WalletId, parked.ReferenceId,
+		commons.TX_TYPE_DEDUCT, wallet.TX_OPER_INFO)
+	if err != nil {
+		return commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	if declinedTX == nil {
+		return nil
+	}
+
+	// expire reversal
+	err = reversal.SetExpired(parked.PendingId)
+	if err != nil {
+		return commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	logger.LogWarning(fmt.Sprintf("%s - parked deduct reversal tx-id=%s expired, original tx-id=%s was declined",
+		helpers.GetFunctionName(), parked.TxID, parked.ReferenceId))
+
+	return nil
+}
@@ -24,69 +24,76 @@ package services
 
 import (
 	"fmt"
-	"github.com/gofiber/fiber/v2"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
 	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger" 
+	reversal "github.com/kueski-dev/paymentology-paymethods/models/reversal"
 	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
 	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 
 // Handles a Deduct Request
-func DeductReversal(c *fiber.Ctx) (*commons.RespSingleInt, error) {
+func DeductReversal(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
 	var err error
 
-	// Parse body
-	req := new(commons.Req)
-	err = c.BodyParser(req)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
-	}
-
-	// map request to JSON
-	reqJS, checksumData, err := commons.MapReqWithRefToJSON(req)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
-	}
-
-	// verify checksum
-	if commons.GetCheckSum(checksumData) != reqJS.Checksum {
-		logger.LogWarning(helpers.GetFunctionName() + 
-				fmt.Sprintf(" authentication fail method=%s tx-id=%s", reqJS.MethodName, reqJS.TxID))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
-	}
-	
-	// protect request values
-	err = commons.ProtectReqWithRefValues(reqJS)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
-	}
-
 	// get original deduct transaction
-	originalTX, err := wallet.GetTransaction(reqJS.Reference, reqJS.ReferenceID, true)
+	originalTX, err := wallet.GetOriginalTransaction(reqJS.Reference, reqJS.ReferenceID, commons.TX_TYPE_DEDUCT, wallet.TX_OPER_WITHDRAW)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
 	// check if original deduct transaction exists
 	if originalTX == nil {
-		// if original deduct tx not exists, it was never processed
-		logger.LogWarning(helpers.GetFunctionName() + "- deduct reversal without original deduct transaction with tx-id=" + reqJS.ReferenceID)
-		return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
+		// the original deduct tx was not booked yet, a declined deduct
+		// is never an original, the reversal is parked until it is recorded
+		logger.LogWarning(helpers.GetFunctionName() + "- deduct reversal parked without original transaction with tx-id=" + reqJS.ReferenceID)
+		err = reversal.Park(reqJS.MethodName, reqJS.TxID, reqJS.Reference, reqJS.ReferenceID, reqJS.RequestAmount, jsonReq)
+		if err != nil {
+			return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
 	}
 
-	// convert request to JSON
-	jsonReq, err := commons.MapToJSON(reqJS)
+	// reverse original transaction
+	_, err = reverseDeduct(reqJS, jsonReq, originalTX)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, err
 	}
 
-	// withdraw blocked balance
-	err = wallet.WithdrawBlockedBalance(reqJS.Reference, reqJS.RequestAmount, commons.TX_TYPE_DEDUCT_REVERSAL,
-		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), string(jsonReq))
+	// return response
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
+
+
+// Reverses an original deduct transaction, returns false when
+// the reversal is rejected by the authorization lifecycle
+func reverseDeduct(reqJS *commons.ReqWithRefJSON, jsonReq string, originalTX *wallet.WalletTransaction) (bool, error) {
+
+	// the authorization lifecycle is checked with the balance update,
+	// invalid transitions are only logged
+	check := commons.AuthorizationCheck(reqJS, originalTX.TypeId, commons.TX_TYPE_DEDUCT_REVERSAL, false)
+
+	// withdraw blocked balance up to the amount not yet reversed
+	result, err := wallet.ReverseTransaction(originalTX, reqJS.TxID, reqJS.TxAmount(), wallet.BALANCE_WITHDRAW_BLOCKED, check, commons.TX_TYPE_DEDUCT_REVERSAL,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	if result.Rejected {
+		return false, nil
 	}
 
-	// return response
-	return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
-}
\ No newline at end of file
+	// duplicated reversals are only acknowledged, over reversals
+	// are acknowledged and flagged for manual review
+	if result.Duplicated {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated deduct reversal tx-id=%s original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.State))
+	} else if result.Review {
+		logger.LogWarning(fmt.Sprintf("%s - deduct reversal over original tx-id=%s amount=%s reversed=%s requested=%s flagged for review",
+			helpers.GetFunctionName(), reqJS.ReferenceID, result.OriginalAmount, result.ReversedAmount, result.RequestedAmount))
+	} else {
+		logger.LogInfo(fmt.Sprintf("%s - deduct reversal original tx-id=%s amount=%s reversed=%s state=%s",
+			helpers.GetFunctionName(), reqJS.ReferenceID, result.OriginalAmount, result.ReversedAmount, result.State))
+	}
+
+	return true, nil
+}
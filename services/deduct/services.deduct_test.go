@@ -0,0 +1,77 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+package services
+
+import (
+	"testing"
+	mcc "github.com/kueski-dev/paymentology-paymethods/models/mcc"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// Program deny rule of the test terminal
+const testTerminal = "PROGRAM-1"
+
+
+// Stubs the MCC rules lookup with a program deny rule on testTerminal
+func stubProgramDenyRule(t *testing.T) {
+	getMCCRulesOrig := getMCCRules
+	t.Cleanup(func() { getMCCRules = getMCCRulesOrig })
+
+	getMCCRules = func(programID string, groupID string, walletID string) (*mcc.WalletMCCRules, error) {
+		rules := &mcc.WalletMCCRules{}
+		if programID == testTerminal {
+			rules.Rules = append(rules.Rules, mcc.MCCRule{ScopeType: mcc.MCC_SCOPE_PROGRAM,
+				ScopeId: testTerminal, MCC: "7995", RuleType: mcc.MCC_RULE_DENY})
+		}
+		return rules, nil
+	}
+}
+
+
+// Builds a protected Deduct request as the engine passes it to the handler
+func newProtectedDeduct(terminalID string, mccCode string) *commons.ReqJSON {
+	reqJS := new(commons.ReqJSON)
+	reqJS.MethodName = "Deduct"
+	reqJS.TerminalId = terminalID
+	reqJS.Reference = "wallet-1"
+	reqJS.TxID = "tx-1"
+	reqJS.TxData = &map[string]string{commons.KLV_MERCHANT_CATEGORY_CODE: mccCode}
+	commons.ProtectReqValues(reqJS)
+	return reqJS
+}
+
+
+func TestCheckMCCProgramDenyRule(t *testing.T) {
+	stubProgramDenyRule(t)
+	walletInfo := &wallet.WalletInfo{WalletId: "wallet-1", GroupId: "group-1"}
+
+	tests := []struct {
+		name 		string
+		terminalID 	string
+		mccCode 	string
+		declined 	bool
+	}{
+		{"denied code on the program terminal", testTerminal, "7995", true},
+		{"other code on the program terminal", testTerminal, "5411", false},
+		{"denied code on other terminal", "PROGRAM-2", "7995", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqJS := newProtectedDeduct(tt.terminalID, tt.mccCode)
+			if reqJS.TerminalId != "" {
+				t.Fatalf("terminal id was not protected")
+			}
+
+			reason, err := checkMCC(reqJS, walletInfo)
+			if err != nil {
+				t.Fatalf("checkMCC error=%s", err.Error())
+			}
+			if (reason != "") != tt.declined {
+				t.Errorf("checkMCC reason=%q, declined=%t expected", reason, tt.declined)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the authorization engine, it runs the shared
+// request pipeline for the registered methods: validate, verify
+// checksum, map, protect, convert to JSON and call the method
+// business handler. It does not depend on any transport.
+package services
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"time"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	money "github.com/kueski-dev/paymentology-paymethods/helpers/amount"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	request "github.com/kueski-dev/paymentology-paymethods/models/request"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+	registry "github.com/kueski-dev/paymentology-paymethods/services/registry"
+)
+
+
+// Function AuthorizeXML decodes a XML-RPC request body and
+// runs the request pipeline, returns the decoded request and
+// the authorization decision
+func AuthorizeXML(body []byte) (*commons.Req, *commons.Decision, error) {
+
+	// decode request
+	req := new(commons.Req)
+	err := xml.Unmarshal(body, req)
+	if err != nil {
+		return nil, nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	decision, err := Authorize(req)
+	return req, decision, err
+}
+
+
+// Function Authorize runs the request pipeline for a decoded request
+func Authorize(req *commons.Req) (*commons.Decision, error) {
+
+	// get method
+	method, ok := registry.Get(req.MethodName)
+	if !ok {
+		logger.LogError(fmt.Sprintf("%s - method=%s is not registered", helpers.GetFunctionName(), req.MethodName))
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+	if !method.Enabled {
+		logger.LogWarning(fmt.Sprintf("%s - method=%s is not enabled", helpers.GetFunctionName(), req.MethodName))
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// validate request params
+	err := commons.ValidateAndLogReq(req, method.Schema)
+	if err != nil {
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// verify terminal
+	terminalID := commons.GetParamStr(req, commons.GetParamPosition(method.Schema, "TerminalID"))
+	txID := commons.GetParamStr(req, commons.GetParamPosition(method.Schema, "TransactionID"))
+	if !commons.IsTerminal(terminalID) {
+		logSecurityEvent(req.MethodName, terminalID, txID, "unknown terminal")
+		return commons.NewDecision(commons.RESP_CODE_SECURITY_VIOLATION), nil
+	}
+
+	// verify checksum with the terminal active keys
+	checksum := commons.GetParamStr(req, commons.GetParamPosition(method.Schema, "Checksum"))
+	keyID, ok := commons.VerifyCheckSum(terminalID, BuildChecksumData(req, method), checksum)
+	if !ok {
+		logger.LogWarning(helpers.GetFunctionName() +
+				fmt.Sprintf(" authentication fail method=%s tx-id=%s", req.MethodName, txID))
+		return commons.NewDecision(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
+	}
+	logger.LogInfo(fmt.Sprintf("%s - checksum verified method=%s tx-id=%s terminal-id=%s key-id=%s",
+		helpers.GetFunctionName(), req.MethodName, txID, terminalID, keyID))
+
+	// answer a retried request of the same terminal with the stored response
+	response, ok, err := request.GetResponse(terminalID, req.MethodName, txID)
+	if err != nil {
+		logger.LogError(err.Error())
+	}
+	if ok {
+		logger.LogInfo(fmt.Sprintf("%s - retried request method=%s tx-id=%s answered with the stored response",
+			helpers.GetFunctionName(), req.MethodName, txID))
+		return commons.NewReplayDecision(response), nil
+	}
+
+	// check transaction date replay window
+	txDate := commons.GetParamStr(req, commons.GetParamPosition(method.Schema, "TransactionDate"))
+	txTime, err := commons.ParseTxDate(txDate)
+	if err != nil {
+		logSecurityEvent(req.MethodName, terminalID, txID, "invalid transaction date " + txDate)
+		return commons.NewDecision(commons.RESP_CODE_SECURITY_VIOLATION), nil
+	}
+	if !commons.IsTxDateInWindow(txTime, time.Now()) {
+		logSecurityEvent(req.MethodName, terminalID, txID, "transaction date " + txDate + " out of window")
+		return commons.NewDecision(commons.RESP_CODE_SECURITY_VIOLATION), nil
+	}
+
+	// check amount, a non negative integer in minor units
+	amountPos := commons.GetParamPosition(method.Schema, "Amount")
+	if amountPos >= 0 {
+		_, err = money.ParseMinorUnits(commons.GetParamStr(req, amountPos))
+		if err != nil {
+			logger.LogWarning(fmt.Sprintf("%s - invalid amount method=%s tx-id=%s error=%s",
+				helpers.GetFunctionName(), req.MethodName, txID, err.Error()))
+			return commons.NewDecision(commons.RESP_CODE_INVALID_AMOUNT), nil
+		}
+	}
+
+	// map request
+	reqJS, err := method.Map(req)
+	if err != nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	reqJS.Header().TxTime = txTime
+
+	return execute(method, reqJS)
+}
+
+
+// Function AuthorizeRequest runs the business handler of a mapped
+// request, the request is trusted and the checksum is not verified.
+// Used by batch jobs and other transports.
+func AuthorizeRequest(reqJS commons.Request) (*commons.Decision, error) {
+
+	// get method
+	method, ok := registry.Get(reqJS.Header().MethodName)
+	if !ok {
+		return nil, commons.RaiseError(helpers.GetFunctionName(),
+			fmt.Sprintf("method=%s is not registered", reqJS.Header().MethodName))
+	}
+	if !method.Enabled {
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// parse transaction date, the replay window is not checked
+	if reqJS.Header().TxTime.IsZero() {
+		reqJS.Header().TxTime, _ = commons.ParseTxDate(reqJS.Header().TxDate)
+	}
+
+	return execute(method, reqJS)
+}
+
+
+// Checks the request currency, protects the request values, converts
+// the request to JSON and calls the method business handler
+func execute(method *registry.Method, reqJS commons.Request) (*commons.Decision, error) {
+
+	// check the transaction currency with the wallet currency
+	if amountReq, ok := reqJS.(commons.AmountRequest); ok {
+		approved, err := checkCurrency(method, amountReq)
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			decision := commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR)
+			decision.TxID = reqJS.Header().TxID
+			decision.TerminalID = reqJS.Header().TerminalId
+			return decision, nil
+		}
+	}
+
+	// protect request values
+	commons.ProtectReqValues(reqJS)
+
+	// convert request to JSON
+	jsonReq, err := commons.MapToJSON(reqJS)
+	if err != nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// call method handler
+	decision, err := method.Handler(reqJS, string(jsonReq))
+	if err != nil {
+		return nil, err
+	}
+	if decision == nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), "method=" + method.Name + " decision was nil")
+	}
+	decision.TxID = reqJS.Header().TxID
+	decision.TerminalID = reqJS.Header().ProgramId
+
+	return decision, nil
+}
+
+
+// Sets the request amount in the wallet currency, returns false when
+// the currency does not match and it cannot be converted. Advice
+// messages are never declined, they are booked and flagged for review.
+// Requests of unknown wallets are left to the method business handler.
+func checkCurrency(method *registry.Method, reqJS commons.AmountRequest) (bool, error) {
+
+	// get wallet currency
+	walletCurrency, err := wallet.GetCurrency(reqJS.Header().Reference)
+	if err != nil {
+		logger.LogWarning(err.Error())
+		return true, nil
+	}
+
+	// convert amount
+	reqAmount := reqJS.Amount()
+	currencyCode := reqAmount.CurrencyCode
+	convert := commons.ConvertCurrency
+	if method.Advice {
+		convert = commons.ConvertAdviceCurrency
+	}
+	approved, err := convert(reqAmount, walletCurrency)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	if !approved && method.Advice {
+		logger.LogWarning(fmt.Sprintf("%s - currency flagged for review method=%s tx-id=%s amount=%s currency=%s amount=%s wallet currency=%s",
+			helpers.GetFunctionName(), reqJS.Header().MethodName, reqJS.Header().TxID, reqAmount.OriginalAmount,
+			currencyCode, reqAmount.RequestAmount, walletCurrency))
+		return true, nil
+	}
+	if !approved {
+		logger.LogWarning(fmt.Sprintf("%s - currency declined method=%s tx-id=%s currency=%s wallet currency=%s",
+			helpers.GetFunctionName(), reqJS.Header().MethodName, reqJS.Header().TxID, currencyCode, walletCurrency))
+	} else if currencyCode != "" && currencyCode != walletCurrency {
+		logger.LogInfo(fmt.Sprintf("%s - currency converted method=%s tx-id=%s amount=%s currency=%s amount=%s wallet currency=%s",
+			helpers.GetFunctionName(), reqJS.Header().MethodName, reqJS.Header().TxID, reqAmount.OriginalAmount,
+			currencyCode, reqAmount.RequestAmount, walletCurrency))
+	}
+
+	return approved, nil
+}
+
+
+// Function SaveResponse stores the response sent for a final decision
+// made by a method handler, retried requests are answered with it.
+// Timeouts of requests still in process are not stored.
+func SaveResponse(methodName string, decision *commons.Decision, response string) {
+	if decision.TxID == "" || decision.TerminalID == "" || decision.IsReplay() || !decision.IsFinal() {
+		return
+	}
+	err := request.SaveResponse(decision.TerminalID, methodName, decision.TxID, decision.ResultCode, response)
+	if err != nil {
+		logger.LogError(err.Error())
+	}
+}
+
+
+// Writes a structured security log entry
+func logSecurityEvent(methodName string, terminalID string, txID string, reason string) {
+	entry, err := json.Marshal(map[string]string{
+		"event": "security-violation",
+		"method-name": methodName,
+		"terminal-id": terminalID,
+		"tx-id": txID,
+		"reason": reason,
+	})
+	if err != nil {
+		logger.LogError(helpers.GetFunctionName() + "- " + err.Error())
+		return
+	}
+	logger.LogWarning(string(entry))
+}
+
+
+// Function BuildChecksumData builds the checksum data with the
+// method name and the params in the method checksum fields order
+func BuildChecksumData(req *commons.Req, method *registry.Method) string {
+	data := req.MethodName
+	for _, field := range method.ChecksumFields {
+		data += commons.GetParamStr(req, commons.GetParamPosition(method.Schema, field))
+	}
+	return data
+}
@@ -21,69 +21,109 @@ package services
 
 import (
 	"fmt"
-	"github.com/gofiber/fiber/v2"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
 	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger" 
+	request "github.com/kueski-dev/paymentology-paymethods/models/request"
 	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
 	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 // Handles a Load Adjustment request
-func LoadAdjustment(c *fiber.Ctx) (*commons.RespSingleInt, error) {
+func LoadAdjustment(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
 	var err error
 
-	// Parse body
-	req := new(commons.Req)
-	err = c.BodyParser(req)
+	// get original transaction
+	originalTX, err := wallet.GetOriginalTransaction(reqJS.Reference, reqJS.ReferenceID, commons.TX_TYPE_LOAD_AUTH, wallet.TX_OPER_INFO)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	// check if original transaction exists
+	if originalTX == nil {
+		// if original load auth tx not exists, it was never processed, the
+		// funds were moved and the amount is credited without pending credit
+		logger.LogWarning(helpers.GetFunctionName() + "- load adjustment without original load auth transaction with tx-id=" + reqJS.ReferenceID)
+		return loadAdjustmentWithoutOriginal(reqJS, jsonReq)
+	}
 
-	// map request to JSON
-	reqJS, checksumData, err := commons.MapReqWithRefToJSON(req)
+	// release the pending credit and credit the available balance once,
+	// invalid lifecycle transitions are only logged
+	check := commons.AuthorizationCheck(reqJS, originalTX.TypeId, commons.TX_TYPE_LOAD_ADJUSTMENT, false)
+	result, err := wallet.AdjustTransaction(originalTX, reqJS.TxID, reqJS.TxAmount(), wallet.BALANCE_CREDIT_PENDING, check, commons.TX_TYPE_LOAD_ADJUSTMENT,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	if result.Rejected {
+		return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+	}
 
-	// verify checksum
-	if commons.GetCheckSum(checksumData) != reqJS.Checksum {
-		logger.LogWarning(helpers.GetFunctionName() + 
-				fmt.Sprintf(" authentication fail method=%s tx-id=%s", reqJS.MethodName, reqJS.TxID))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
+	// duplicated adjustments and adjustments of an original
+	// already adjusted or reversed are only logged
+	if result.Duplicated {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated load adjustment tx-id=%s original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.State))
+	} else if result.AppliedAmount == 0 {
+		logger.LogWarning(fmt.Sprintf("%s - load adjustment tx-id=%s not applied, original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.PreviousState))
+	} else if result.DebtAmount < 0 {
+		logger.LogInfo(fmt.Sprintf("%s - load adjustment tx-id=%s walletid=%s paid debt=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.Reference, -result.DebtAmount))
 	}
 
-	// protect request values
-	err = commons.ProtectReqWithRefValues(reqJS)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	// apply the reversals received before the load adjustment
+	if !result.Duplicated {
+		applyParkedReversals(reqJS.Reference, reqJS.TxID)
 	}
 
-	// get original transaction
-	originalTX, err := wallet.GetTransaction(reqJS.Reference, reqJS.ReferenceID, true)
+	// return response
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
+
+
+// Credits a load adjustment without original load auth once, without
+// original there is no link to detect a duplicated adjustment and the
+// request is reserved by terminal, method and tx-id as a Deduct
+func loadAdjustmentWithoutOriginal(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
+
+	// reserve request
+	reserved, resultCode, err := request.Reserve(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
-	// check if original transaction exists
-	if originalTX == nil {
-		// if original tx not exists, it was never processed
-		logger.LogWarning(helpers.GetFunctionName() + "- load adjustment without original deduct transaction with tx-id=" + reqJS.ReferenceID)
-		return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
+	if !reserved {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated load adjustment tx-id=%s stored result-code=%s", helpers.GetFunctionName(),
+						reqJS.TxID, resultCode))
+		if resultCode == "" {
+			// the first request is still in process
+			return commons.NewDecision(commons.RESP_CODE_TX_TIMEOUT), nil
+		}
+		return commons.NewDecision(resultCode), nil
 	}
 
-	// convert request to JSON
-	jsonReq, err := commons.MapToJSON(reqJS)
+	// credit the available balance, the credit pays the debt first
+	debtAmount, err := wallet.DepositAvailableBalanceWithDebt(reqJS.Reference, reqJS.TxAmount(), commons.TX_TYPE_LOAD_ADJUSTMENT,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
+		// allow the request to be retried
+		errRel := request.Release(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID)
+		if errRel != nil {
+			logger.LogError(errRel.Error())
+		}
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	if debtAmount < 0 {
+		logger.LogInfo(fmt.Sprintf("%s - load adjustment tx-id=%s walletid=%s paid debt=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.Reference, -debtAmount))
+	}
 
-	// withdraw available balance
-	err = wallet.WithdrawBlockedBalance(reqJS.Reference, reqJS.RequestAmount, commons.TX_TYPE_LOAD_ADJUSTMENT, 
-		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], 
-		reqJS.ReferenceID, reqJS.Narrative), string(jsonReq))
+	// store result code
+	err = request.Complete(reqJS.ProgramId, reqJS.MethodName, reqJS.TxID, commons.RESP_CODE_APPROVED)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		logger.LogError(err.Error())
 	}
 
-	// return response
-	return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
-}
\ No newline at end of file
+	// apply the reversals received before the load adjustment
+	applyParkedReversals(reqJS.Reference, reqJS.TxID)
+
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
@@ -6,56 +6,60 @@ package services
 
 import (
 	"fmt"
-	"github.com/gofiber/fiber/v2"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
-	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger" 
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
 	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
 	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 // Handles a Load Auth Reversal request
-func LoadAuthReversal(c *fiber.Ctx) (*commons.RespSingleInt, error) {
+func LoadAuthReversal(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
 	var err error
 
-	// Parse body
-	req := new(commons.Req)
-	err = c.BodyParser(req)
+	// get original load auth transaction
+	originalTX, err := wallet.GetOriginalTransaction(reqJS.Reference, reqJS.ReferenceID, commons.TX_TYPE_LOAD_AUTH, wallet.TX_OPER_INFO)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	if originalTX == nil {
+		// check the authorization lifecycle, invalid transitions are only logged
+		valid, err := commons.TransitionAuthorization(reqJS, commons.TX_TYPE_LOAD_AUTH, commons.TX_TYPE_LOAD_AUTH_REVERSAL)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+		}
 
-	// map request to JSON
-	reqJS, checksumData, err := commons.MapReqWithRefToJSON(req)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		// without original load auth there is no pending credit to release
+		logger.LogWarning(helpers.GetFunctionName() + "- load auth reversal without original load auth transaction with tx-id=" + reqJS.ReferenceID)
+		_, err = wallet.PostTransaction(reqJS.Reference, reqJS.TxAmount(), commons.TX_TYPE_LOAD_AUTH_REVERSAL, commons.TX_OPER_INFO,
+			fmt.Sprintf("%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.Narrative), jsonReq)
+		if err != nil {
+			return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
 	}
 
-	// verify checksum
-	if commons.GetCheckSum(checksumData) != reqJS.Checksum {
-		logger.LogWarning(helpers.GetFunctionName() + 
-				fmt.Sprintf(" authentication fail method=%s tx-id=%s", reqJS.MethodName, reqJS.TxID))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
-	}
-
-	// protect request values
-	err = commons.ProtectReqWithRefValues(reqJS)
+	// release the pending credit up to the amount not yet released,
+	// invalid lifecycle transitions are only logged
+	check := commons.AuthorizationCheck(reqJS, commons.TX_TYPE_LOAD_AUTH, commons.TX_TYPE_LOAD_AUTH_REVERSAL, false)
+	result, err := wallet.ReverseTransaction(originalTX, reqJS.TxID, reqJS.TxAmount(), wallet.BALANCE_RELEASE_PENDING, check, commons.TX_TYPE_LOAD_AUTH_REVERSAL,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
-
-	// convert request to JSON
-	jsonReq, err := commons.MapToJSON(reqJS)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	if result.Rejected {
+		return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
 	}
-
-	// post transaction in the wallet
-	_, err = wallet.PostTransaction(reqJS.Reference, reqJS.RequestAmount, commons.TX_TYPE_LOAD_AUTH_REVERSAL, commons.TX_OPER_INFO,
-		fmt.Sprintf("%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.Narrative), string(jsonReq))
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	if result.Duplicated {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated load auth reversal tx-id=%s original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.State))
+	} else if result.Review {
+		logger.LogWarning(fmt.Sprintf("%s - load auth reversal over original tx-id=%s amount=%s released=%s requested=%s flagged for review",
+			helpers.GetFunctionName(), reqJS.ReferenceID, result.OriginalAmount, result.ReversedAmount, result.RequestedAmount))
 	}
 
 	// return response
-	return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
 }
\ No newline at end of file
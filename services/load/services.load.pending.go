@@ -0,0 +1,106 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Handles load transactions.
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	reversal "github.com/kueski-dev/paymentology-paymethods/models/reversal"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// Parked reversals method name
+const PARKED_REVERSAL_METHOD = "LoadReversal"
+
+
+// Applies the parked reversals of a recorded load adjustment transaction
+func applyParkedReversals(walletID string, txID string) {
+
+	// get parked reversals
+	parked, err := reversal.GetPending(PARKED_REVERSAL_METHOD, walletID, txID)
+	if err != nil {
+		logger.LogError(err.Error())
+		return
+	}
+
+	for i := range parked {
+		_, err = applyParkedReversal(&parked[i])
+		if err != nil {
+			logger.LogError(err.Error())
+		}
+	}
+}
+
+
+// Function MatchParkedReversals applies the parked load reversals
+// whose original transaction was recorded
+func MatchParkedReversals() error {
+
+	// get parked reversals
+	parked, err := reversal.GetPending(PARKED_REVERSAL_METHOD, "", "")
+	if err != nil {
+		return commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	for i := range parked {
+		_, err = applyParkedReversal(&parked[i])
+		if err != nil {
+			logger.LogError(err.Error())
+		}
+	}
+
+	return nil
+}
+
+
+// Applies a parked reversal when its original transaction
+// was recorded, returns false when it is still pending
+func applyParkedReversal(parked *reversal.PendingReversal) (bool, error) {
+
+	// get original transaction
+	originalTX, err := wallet.GetOriginalTransaction(parked.WalletId, parked.ReferenceId,
+		commons.TX_TYPE_LOAD_ADJUSTMENT, wallet.TX_OPER_DEPOSIT)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	if originalTX == nil {
+		return false, nil
+	}
+
+	// get parked request
+	reqJS := new(commons.ReqWithRefJSON)
+	err = json.Unmarshal([]byte(parked.Data), reqJS)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// reverse original transaction, a reversal rejected by the
+	// authorization lifecycle is flagged for review
+	applied, err := reverseLoad(reqJS, parked.Data, originalTX)
+	if err != nil {
+		return false, err
+	}
+	if !applied {
+		err = reversal.SetReview(parked.PendingId)
+		if err != nil {
+			return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		logger.LogWarning(fmt.Sprintf("%s - parked load reversal tx-id=%s rejected, original tx-id=%s flagged for review",
+			helpers.GetFunctionName(), parked.TxID, parked.ReferenceId))
+		return false, nil
+	}
+	err = reversal.SetApplied(parked.PendingId)
+	if err != nil {
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	logger.LogInfo(fmt.Sprintf("%s - parked load reversal tx-id=%s applied to original tx-id=%s",
+		helpers.GetFunctionName(), parked.TxID, parked.ReferenceId))
+
+	return true, nil
+}
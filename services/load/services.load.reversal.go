@@ -18,69 +18,79 @@ package services
 
 import (
 	"fmt"
-	"github.com/gofiber/fiber/v2"
 	"github.com/kueski-dev/paymentology-paymethods/helpers"
 	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger" 
+	reversal "github.com/kueski-dev/paymentology-paymethods/models/reversal"
 	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
 	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 // Handles a Load Reversal request
-func LoadReversal(c *fiber.Ctx) (*commons.RespSingleInt, error) {
+func LoadReversal(reqJS *commons.ReqWithRefJSON, jsonReq string) (*commons.Decision, error) {
 	var err error
 
-	// Parse body
-	req := new(commons.Req)
-	err = c.BodyParser(req)
+	// get original transaction
+	originalTX, err := wallet.GetOriginalTransaction(reqJS.Reference, reqJS.ReferenceID, commons.TX_TYPE_LOAD_ADJUSTMENT, wallet.TX_OPER_DEPOSIT)
 	if err != nil {
 		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
+	// check if original load adjustment transaction exists
+	if originalTX == nil {
+		// the original load adjustment tx was not processed yet, the reversal
+		// is parked until the original is recorded
+		logger.LogWarning(helpers.GetFunctionName() + "- load reversal parked without original transaction with tx-id=" + reqJS.ReferenceID)
+		err = reversal.Park(reqJS.MethodName, reqJS.TxID, reqJS.Reference, reqJS.ReferenceID, reqJS.RequestAmount, jsonReq)
+		if err != nil {
+			return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+	}
 
-	// map request to JSON
-	reqJS, checksumData, err := commons.MapReqWithRefToJSON(req)
+	// reverse original transaction
+	_, err = reverseLoad(reqJS, jsonReq, originalTX)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		return nil, err
 	}
 
-	// verify checksum
-	if commons.GetCheckSum(checksumData) != reqJS.Checksum {
-		logger.LogWarning(helpers.GetFunctionName() + 
-				fmt.Sprintf(" authentication fail method=%s tx-id=%s", reqJS.MethodName, reqJS.TxID))
-		return commons.BuildSingleIntResp(commons.RESP_CODE_AUTHENTICATION_FAIL), nil
-	}
+	// return response
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
 
-	// protect request values
-	err = commons.ProtectReqWithRefValues(reqJS)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
-	}
 
-	// get original transaction
-	originalTX, err := wallet.GetTransaction(reqJS.Reference, reqJS.ReferenceID, true)
+// Reverses an original load adjustment transaction, returns false
+// when the reversal is rejected by the authorization lifecycle
+func reverseLoad(reqJS *commons.ReqWithRefJSON, jsonReq string, originalTX *wallet.WalletTransaction) (bool, error) {
+
+	// the authorization lifecycle is checked with the balance update,
+	// invalid transitions are only logged
+	check := commons.AuthorizationCheck(reqJS, originalTX.TypeId, commons.TX_TYPE_LOAD_REVERSAL, false)
+
+	// debit available balance up to the amount not yet reversed
+	result, err := wallet.ReverseTransaction(originalTX, reqJS.TxID, reqJS.TxAmount(), wallet.BALANCE_DEBIT_AVAILABLE, check, commons.TX_TYPE_LOAD_REVERSAL,
+		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], reqJS.ReferenceID, reqJS.Narrative), jsonReq)
 	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		return false, commons.RaiseError(helpers.GetFunctionName(), err.Error())
 	}
-	// check if original transaction exists
-	if originalTX == nil {
-		// if original tx not exists, it was never processed
-		logger.LogWarning(helpers.GetFunctionName() + "- load adjustment without original load adjustment transaction with tx-id=" + reqJS.ReferenceID)
-		return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
+	if result.Rejected {
+		return false, nil
 	}
 
-	// convert request to JSON
-	jsonReq, err := commons.MapToJSON(reqJS)
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	// duplicated reversals are only acknowledged, over reversals
+	// are acknowledged and flagged for manual review
+	if result.Duplicated {
+		logger.LogWarning(fmt.Sprintf("%s - duplicated load reversal tx-id=%s original tx-id=%s state=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.ReferenceID, result.State))
+	} else if result.Review {
+		logger.LogWarning(fmt.Sprintf("%s - load reversal over original tx-id=%s amount=%s reversed=%s requested=%s flagged for review",
+			helpers.GetFunctionName(), reqJS.ReferenceID, result.OriginalAmount, result.ReversedAmount, result.RequestedAmount))
+	} else {
+		logger.LogInfo(fmt.Sprintf("%s - load reversal original tx-id=%s amount=%s reversed=%s state=%s",
+			helpers.GetFunctionName(), reqJS.ReferenceID, result.OriginalAmount, result.ReversedAmount, result.State))
 	}
-
-	// withdraw available balance
-	err = wallet.DepositBlockedBalance(reqJS.Reference, reqJS.RequestAmount, commons.TX_TYPE_LOAD_REVERSAL, 
-		fmt.Sprintf("%s | original-tx-id=%s | %s", commons.RESP_CODE[commons.RESP_CODE_APPROVED], 
-		reqJS.ReferenceID, reqJS.Narrative), string(jsonReq))
-	if err != nil {
-		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	if result.DebtAmount > 0 {
+		logger.LogWarning(fmt.Sprintf("%s - load reversal tx-id=%s walletid=%s recorded debt=%s",
+			helpers.GetFunctionName(), reqJS.TxID, reqJS.Reference, result.DebtAmount))
 	}
 
-	// return response
-	return commons.BuildSingleIntResp(commons.RESP_CODE_APPROVED), nil
-}
\ No newline at end of file
+	return true, nil
+}
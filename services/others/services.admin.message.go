@@ -0,0 +1,36 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+/* AdministrativeMessage some business logic:
+	Administrative messages are notifications sent by Paymentology to the
+	store of value, they do not move funds. The message is stored with its
+	decoded transaction data for operations review and it is always approved,
+	any other response is treated as a failure and escalated.
+*/
+
+package services
+
+import (
+	"fmt"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	message "github.com/kueski-dev/paymentology-paymethods/models/message"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// Handles an Administrative Message request
+func AdministrativeMessage(reqJS *commons.AdminMsgReqJSON, jsonReq string) (*commons.Decision, error) {
+	var err error
+
+	// store the administrative message
+	_, err = message.PostAdminMessage(reqJS.Reference, reqJS.MessageType, reqJS.Message,
+		reqJS.TxID, reqJS.TxDate, jsonReq)
+	if err != nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+	logger.LogInfo(fmt.Sprintf("%s - administrative message type=%s tx-id=%s", helpers.GetFunctionName(),
+					reqJS.MessageType, reqJS.TxID))
+
+	// return response
+	return commons.NewDecision(commons.RESP_CODE_APPROVED), nil
+}
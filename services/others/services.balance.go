@@ -0,0 +1,65 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+/* Balance some business logic:
+	A Balance request is sent when a cardholder makes a balance enquiry,
+	for example at an ATM. The store of value returns the result code and
+	the available balance of the wallet in minor units (cents).
+*/
+
+package services
+
+import (
+	"fmt"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	card "github.com/kueski-dev/paymentology-paymethods/models/card"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// Handles a Balance request
+func Balance(reqJS *commons.BalanceReqJSON, jsonReq string) (*commons.Decision, error) {
+	var err error
+
+	// get card info
+	cardInfo, err:= card.GetInfo(reqJS.Reference, (*(*reqJS).TxData)["LastfourDigitsPAN"])
+	if err != nil {
+		logger.LogError(err.Error())
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// check card is active or expired
+	if cardInfo == nil || !card.IsActive(cardInfo) {
+		logger.LogInfo(fmt.Sprintf("%s - card walletid=%s lastfour=%s is not active", helpers.GetFunctionName(),
+						reqJS.Reference, (*(*reqJS).TxData)["LastfourDigitsPAN"]))
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// get wallet info
+	walletInfo, err:= wallet.GetInfo(reqJS.Reference)
+	if err != nil {
+		logger.LogError(err.Error())
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// check wallet is active
+	if walletInfo == nil || !wallet.IsActive(walletInfo) {
+		logger.LogInfo(fmt.Sprintf("%s - walletid=%s is not active", helpers.GetFunctionName(), reqJS.Reference))
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// post balance enquiry in the wallet
+	_, err = wallet.PostTransaction(walletInfo.WalletId, wallet.NewTxAmount(walletInfo.AvalilableBalance), commons.TX_TYPE_BALANCE, commons.TX_OPER_INFO,
+		fmt.Sprintf("%s | BALANCE ENQUIRY", commons.RESP_CODE[commons.RESP_CODE_APPROVED]), jsonReq)
+	if err != nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// return the balance in minor units of the wallet currency
+	exponent, ok := commons.CurrencyExponent(walletInfo.CurrencyCode)
+	if !ok {
+		exponent = commons.CURRENCY_DEFAULT_EXPONENT
+	}
+	return commons.NewBalanceDecision(commons.RESP_CODE_APPROVED, walletInfo.AvalilableBalance.MinorUnits(exponent)), nil
+}
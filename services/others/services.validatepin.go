@@ -0,0 +1,127 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+/* ValidatePIN some business logic:
+	A ValidatePIN request is sent before PIN based ATM and POS transactions.
+	The PIN arrives as an ISO 9564 format 0 PIN block, it is decoded with the
+	card number and verified against the PIN hash stored for the card.
+	Every incorrect PIN increases the card failed tries counter, when the
+	configured limit is reached the card answers with allowable PIN tries exceeded.
+*/
+
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	card "github.com/kueski-dev/paymentology-paymethods/models/card"
+	wallet "github.com/kueski-dev/paymentology-paymethods/models/wallet"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// PIN block constants
+const (
+	PIN_BLOCK_LENGTH = 16
+	PIN_BLOCK_FORMAT_0 = '0'
+	PAN_MIN_LENGTH = 13
+)
+
+// Handles a Validate PIN request
+func ValidatePIN(reqJS *commons.PINReqJSON, jsonReq string) (*commons.Decision, error) {
+	var err error
+
+	// decode the pin block
+	pin, respCode := decodePINBlock(reqJS.PINBlock, reqJS.CardNumber)
+
+	// get card info
+	cardInfo, err:= card.GetInfo(reqJS.Reference, reqJS.Last4)
+	if err != nil {
+		logger.LogError(err.Error())
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// check card is active or expired
+	if cardInfo == nil || !card.IsActive(cardInfo) {
+		logger.LogInfo(fmt.Sprintf("%s - card walletid=%s lastfour=%s is not active", helpers.GetFunctionName(),
+						reqJS.Reference, reqJS.Last4))
+		return commons.NewDecision(commons.RESP_CODE_DO_NOT_HONOR), nil
+	}
+
+	// verify the pin when the pin block was decoded
+	if respCode == commons.RESP_CODE_APPROVED {
+		var result string
+		result, err = card.VerifyPIN(cardInfo.CardId, pin, configs.PINMaxTries)
+		if err != nil {
+			return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+		}
+		switch result {
+			case card.PIN_RESULT_VALID:
+				respCode = commons.RESP_CODE_APPROVED
+			case card.PIN_RESULT_TRIES_EXCEEDED:
+				respCode = commons.RESP_CODE_PIN_TRIES_EXCEEDED
+			default:
+				respCode = commons.RESP_CODE_INCORRECT_PIN
+		}
+	}
+
+	// post transaction in the wallet
+	_, err = wallet.PostTransaction(reqJS.Reference, wallet.NewTxAmount(0), commons.TX_TYPE_VALIDATE_PIN, commons.TX_OPER_INFO,
+		fmt.Sprintf("%s | PIN VALIDATION", commons.RESP_CODE[respCode]), jsonReq)
+	if err != nil {
+		return nil, commons.RaiseError(helpers.GetFunctionName(), err.Error())
+	}
+
+	// return response
+	return commons.NewDecision(respCode), nil
+}
+
+
+// Function decodePINBlock gets the clear PIN from an ISO 9564
+// format 0 PIN block, returns the PIN and a response code
+func decodePINBlock(pinBlock string, cardNumber string) (string, string) {
+
+	// check pin block and card number lengths
+	if len(pinBlock) != PIN_BLOCK_LENGTH || len(cardNumber) < PAN_MIN_LENGTH {
+		return "", commons.RESP_CODE_INVALID_PIN_BLOCK
+	}
+	block, err := hex.DecodeString(pinBlock)
+	if err != nil {
+		return "", commons.RESP_CODE_INVALID_PIN_BLOCK
+	}
+
+	// build pan block with the 12 rightmost digits excluding the check digit
+	pan, err := hex.DecodeString("0000" + cardNumber[len(cardNumber)-13:len(cardNumber)-1])
+	if err != nil {
+		return "", commons.RESP_CODE_INVALID_PIN_BLOCK
+	}
+
+	// xor pin block and pan block
+	for i := range block {
+		block[i] ^= pan[i]
+	}
+	pinField := fmt.Sprintf("%X", block)
+
+	// check format and pin length
+	if pinField[0] != PIN_BLOCK_FORMAT_0 {
+		return "", commons.RESP_CODE_INVALID_PIN_BLOCK
+	}
+	pinLen := int(block[0] & 0x0F)
+	if pinLen < card.PIN_MIN_LENGTH || pinLen > card.PIN_MAX_LENGTH {
+		return "", commons.RESP_CODE_PIN_LENGTH_ERROR
+	}
+
+	// check pin digits and padding
+	for i := 2; i < len(pinField); i++ {
+		if i < pinLen + 2 && (pinField[i] < '0' || pinField[i] > '9') {
+			return "", commons.RESP_CODE_INVALID_PIN_BLOCK
+		}
+		if i >= pinLen + 2 && pinField[i] != 'F' {
+			return "", commons.RESP_CODE_INVALID_PIN_BLOCK
+		}
+	}
+
+	return pinField[2:(pinLen + 2)], commons.RESP_CODE_APPROVED
+}
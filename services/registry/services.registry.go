@@ -0,0 +1,103 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the Paymentology methods registry, each method
+// has its params schema, checksum fields order and business handler.
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+)
+
+// Function types used by the registered methods
+type MapFunc func(req *commons.Req) (commons.Request, error)
+type HandlerFunc func(reqJS commons.Request, jsonReq string) (*commons.Decision, error)
+
+// Registered method struct, advice messages notify a transaction
+// already made and must be approved and booked
+type Method struct {
+	Name 			string
+	Schema 			[]commons.ParamSchema
+	ChecksumFields 	[]string
+	Map 			MapFunc
+	Handler 		HandlerFunc
+	Enabled 		bool
+	Advice 			bool
+}
+
+// Method info struct for the admin routes
+type MethodInfo struct {
+	Name 			string		`json:"method-name"`
+	Enabled 		bool		`json:"enabled"`
+	Advice 			bool		`json:"advice"`
+	Params 			[]string	`json:"params"`
+	ChecksumFields 	[]string	`json:"checksum-fields"`
+}
+
+var (
+	methods = make(map[string]*Method)
+	methodsMutex sync.RWMutex
+)
+
+
+// Function Register adds a method to the registry
+func Register(method Method) error {
+
+	// check method values
+	if method.Name == "" || method.Schema == nil || method.Map == nil || method.Handler == nil {
+		return fmt.Errorf(helpers.GetFunctionName() + "- method=%s values cannot be empty", method.Name)
+	}
+	for _, field := range method.ChecksumFields {
+		if commons.GetParamPosition(method.Schema, field) < 0 {
+			return fmt.Errorf(helpers.GetFunctionName() + "- method=%s checksum field=%s not in schema", method.Name, field)
+		}
+	}
+
+	methodsMutex.Lock()
+	defer methodsMutex.Unlock()
+
+	// check duplicated methods
+	if _, ok := methods[method.Name]; ok {
+		return fmt.Errorf(helpers.GetFunctionName() + "- method=%s already registered", method.Name)
+	}
+	methods[method.Name] = &method
+
+	logger.LogInfo(fmt.Sprintf("%s - method=%s registered enabled=%t", helpers.GetFunctionName(), method.Name, method.Enabled))
+
+	return nil
+}
+
+
+// Function Get gets a registered method
+func Get(name string) (*Method, bool) {
+	methodsMutex.RLock()
+	defer methodsMutex.RUnlock()
+
+	method, ok := methods[name]
+	return method, ok
+}
+
+
+// Function List gets the registered methods info sorted by name
+func List() []MethodInfo {
+	methodsMutex.RLock()
+	defer methodsMutex.RUnlock()
+
+	list := make([]MethodInfo, 0, len(methods))
+	for _, method := range methods {
+		params := make([]string, len(method.Schema))
+		for i := range method.Schema {
+			params[i] = method.Schema[i].Name
+		}
+		list = append(list, MethodInfo{Name: method.Name, Enabled: method.Enabled, Advice: method.Advice,
+			Params: params, ChecksumFields: method.ChecksumFields})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
@@ -7,6 +7,7 @@ package services
 import( 
 	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
 	memdb "github.com/kueski-dev/paymentology-paymethods/models/memdb"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
 )
 
 // performs services initial activities
@@ -21,6 +22,20 @@ func Start() error {
 		return err
 	}
 
+	// check the ATM detection KLV fields
+	commons.CheckATMFields()
+
+	// register paymentology methods
+	logger.LogInfo("Registering paymentology methods...")
+	err = registerMethods()
+	if err != nil {
+		return err
+	}
+
+	// start parked reversals job
+	logger.LogInfo("Starting parked reversals job...")
+	go runParkedReversalsJob()
+
 	// success
 	logger.LogInfo("Paymentology authorizer services started successfully")
 	return nil
@@ -0,0 +1,59 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the application services
+package services
+
+import (
+	"fmt"
+	"time"
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	"github.com/kueski-dev/paymentology-paymethods/helpers"
+	logger "github.com/kueski-dev/paymentology-paymethods/helpers/logger"
+	reversal "github.com/kueski-dev/paymentology-paymethods/models/reversal"
+	deduct "github.com/kueski-dev/paymentology-paymethods/services/deduct"
+	load "github.com/kueski-dev/paymentology-paymethods/services/load"
+)
+
+
+// Runs the parked reversals job every job interval
+func runParkedReversalsJob() {
+	ticker := time.NewTicker(configs.PendingReversalJobInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		processParkedReversals()
+	}
+}
+
+
+// Applies the parked reversals whose original transaction was
+// recorded, then expires and reports the unmatched reversals
+func processParkedReversals() {
+
+	// match parked reversals
+	err := deduct.MatchParkedReversals()
+	if err != nil {
+		logger.LogError(err.Error())
+	}
+	err = load.MatchParkedReversals()
+	if err != nil {
+		logger.LogError(err.Error())
+	}
+
+	// expire unmatched reversals
+	expired, err := reversal.Expire(time.Now().Add(-configs.PendingReversalTTL))
+	if err != nil {
+		logger.LogError(err.Error())
+		return
+	}
+
+	// report unmatched reversals
+	for _, rev := range expired {
+		logger.LogWarning(fmt.Sprintf("%s - unmatched reversal expired method=%s tx-id=%s wallet-id=%s original tx-id=%s amount=%s",
+			helpers.GetFunctionName(), rev.MethodName, rev.TxID, rev.WalletId, rev.ReferenceId, rev.Amount))
+	}
+	if len(expired) > 0 {
+		logger.LogWarning(fmt.Sprintf("%s - %d unmatched reversals expired", helpers.GetFunctionName(), len(expired)))
+	}
+}
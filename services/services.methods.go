@@ -0,0 +1,130 @@
+// Copyright Kueski. All rights reserved.
+// Use of this source code is not licensed
+
+// Package handles the application services
+package services
+
+import (
+	"github.com/kueski-dev/paymentology-paymethods/configs"
+	commons "github.com/kueski-dev/paymentology-paymethods/services/commons"
+	deduct "github.com/kueski-dev/paymentology-paymethods/services/deduct"
+	load "github.com/kueski-dev/paymentology-paymethods/services/load"
+	others "github.com/kueski-dev/paymentology-paymethods/services/others"
+	registry "github.com/kueski-dev/paymentology-paymethods/services/registry"
+)
+
+// request map functions
+func mapReq(req *commons.Req) (commons.Request, error) {
+	return commons.MapReqToJSON(req)
+}
+func mapReqWithRef(req *commons.Req) (commons.Request, error) {
+	return commons.MapReqWithRefToJSON(req)
+}
+func mapStopReq(req *commons.Req) (commons.Request, error) {
+	return commons.MapStopReqToJSON(req)
+}
+func mapBalanceReq(req *commons.Req) (commons.Request, error) {
+	return commons.MapBalanceReqToJSON(req)
+}
+func mapPINReq(req *commons.Req) (commons.Request, error) {
+	return commons.MapPINReqToJSON(req)
+}
+func mapAdminMsgReq(req *commons.Req) (commons.Request, error) {
+	return commons.MapAdminMsgReqToJSON(req)
+}
+
+
+// Paymentology methods
+var pmtolMethods = []registry.Method{
+	{
+		Name: "Deduct", Schema: commons.SCHEMA_REQ, ChecksumFields: commons.CHECKSUM_REQ, Map: mapReq,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return deduct.Deduct(reqJS.(*commons.ReqJSON), jsonReq)
+		},
+	},
+	{
+		Name: "DeductReversal", Schema: commons.SCHEMA_REQ_WITH_REF, ChecksumFields: commons.CHECKSUM_REQ_WITH_REF, Map: mapReqWithRef, Advice: true,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return deduct.DeductReversal(reqJS.(*commons.ReqWithRefJSON), jsonReq)
+		},
+	},
+	{
+		Name: "DeductAdjustment", Schema: commons.SCHEMA_REQ_WITH_REF, ChecksumFields: commons.CHECKSUM_REQ_WITH_REF, Map: mapReqWithRef, Advice: true,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return deduct.DeductAdjustment(reqJS.(*commons.ReqWithRefJSON), jsonReq)
+		},
+	},
+	{
+		Name: "LoadAdjustment", Schema: commons.SCHEMA_REQ_WITH_REF, ChecksumFields: commons.CHECKSUM_REQ_WITH_REF, Map: mapReqWithRef, Advice: true,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return load.LoadAdjustment(reqJS.(*commons.ReqWithRefJSON), jsonReq)
+		},
+	},
+	{
+		Name: "LoadReversal", Schema: commons.SCHEMA_REQ_WITH_REF, ChecksumFields: commons.CHECKSUM_REQ_WITH_REF, Map: mapReqWithRef, Advice: true,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return load.LoadReversal(reqJS.(*commons.ReqWithRefJSON), jsonReq)
+		},
+	},
+	{
+		Name: "LoadAuth", Schema: commons.SCHEMA_REQ, ChecksumFields: commons.CHECKSUM_REQ, Map: mapReq,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return load.LoadAuth(reqJS.(*commons.ReqJSON), jsonReq)
+		},
+	},
+	{
+		Name: "LoadAuthReversal", Schema: commons.SCHEMA_REQ_WITH_REF, ChecksumFields: commons.CHECKSUM_REQ_WITH_REF, Map: mapReqWithRef, Advice: true,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return load.LoadAuthReversal(reqJS.(*commons.ReqWithRefJSON), jsonReq)
+		},
+	},
+	{
+		Name: "Stop", Schema: commons.SCHEMA_STOP_REQ, ChecksumFields: commons.CHECKSUM_STOP_REQ, Map: mapStopReq,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return others.StopCard(reqJS.(*commons.StopReqJSON), jsonReq)
+		},
+	},
+	{
+		Name: "Balance", Schema: commons.SCHEMA_BALANCE_REQ, ChecksumFields: commons.CHECKSUM_BALANCE_REQ, Map: mapBalanceReq,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return others.Balance(reqJS.(*commons.BalanceReqJSON), jsonReq)
+		},
+	},
+	{
+		Name: "ValidatePIN", Schema: commons.SCHEMA_PIN_REQ, ChecksumFields: commons.CHECKSUM_PIN_REQ, Map: mapPINReq,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return others.ValidatePIN(reqJS.(*commons.PINReqJSON), jsonReq)
+		},
+	},
+	{
+		Name: "AdministrativeMessage", Schema: commons.SCHEMA_ADMIN_MSG_REQ, ChecksumFields: commons.CHECKSUM_ADMIN_MSG_REQ, Map: mapAdminMsgReq,
+		Handler: func(reqJS commons.Request, jsonReq string) (*commons.Decision, error) {
+			return others.AdministrativeMessage(reqJS.(*commons.AdminMsgReqJSON), jsonReq)
+		},
+	},
+}
+
+
+// Registers the Paymentology methods, methods listed in
+// PMTOL_DISABLED_METHODS are registered as not enabled
+func registerMethods() error {
+	for _, method := range pmtolMethods {
+		method.Enabled = !isDisabledMethod(method.Name)
+		err := registry.Register(method)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+
+// Checks if a method is in the disabled methods
+func isDisabledMethod(name string) bool {
+	for _, disabled := range configs.PaymentologyDisabledMethods {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}